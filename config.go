@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/vburenin/ifacemaker/maker"
+	"gopkg.in/yaml.v3"
+)
+
+// configTarget describes a single interface to generate. The keys mirror
+// the long command line flags.
+type configTarget struct {
+	Files           []string     `yaml:"files"`
+	SourceDir       string       `yaml:"dir"`
+	Package         string       `yaml:"package"`
+	Type            string       `yaml:"type"`
+	StructType      string       `yaml:"struct"`
+	IfaceName       string       `yaml:"iface"`
+	PkgName         string       `yaml:"pkg"`
+	WithPromoted    *bool        `yaml:"promoted"`
+	EmbedIfaces     *bool        `yaml:"embed-interfaces"`
+	Receiver        string       `yaml:"receiver"`
+	IfaceComment    string       `yaml:"iface-comment"`
+	ImportModule    string       `yaml:"import-module"`
+	ExcludeMethods  []string     `yaml:"exclude-methods"`
+	Include         []string     `yaml:"include"`
+	Exclude         []string     `yaml:"exclude"`
+	Roles           []configRole `yaml:"roles"`
+	WithNotExported *bool        `yaml:"not-exported"`
+	UsedBy          string       `yaml:"used-by"`
+	CopyDocs        *bool        `yaml:"doc"`
+	CopyTypeDoc     *bool        `yaml:"type-doc"`
+	Comment         string       `yaml:"comment"`
+	Template        string       `yaml:"template"`
+	Workers         int          `yaml:"workers"`
+	Tags            []string     `yaml:"tags"`
+	GOOS            string       `yaml:"goos"`
+	GOARCH          string       `yaml:"goarch"`
+	Tests           *bool        `yaml:"tests"`
+	Platforms       []string     `yaml:"platforms"`
+	Output          string       `yaml:"output"`
+	MockOutput      string       `yaml:"mock-output"`
+	WrapperOutput   string       `yaml:"wrapper-output"`
+	TracedOutput    string       `yaml:"traced-output"`
+	MetricsOutput   string       `yaml:"metrics-output"`
+	LoggingOutput   string       `yaml:"logging-output"`
+	RetryOutput     string       `yaml:"retry-output"`
+	Assert          *bool        `yaml:"assert"`
+	AssertOutput    string       `yaml:"assert-output"`
+
+	Metrics  configMetrics `yaml:"metrics"`
+	Redact   []string      `yaml:"redact"`
+	NoRedact *bool         `yaml:"no-redact"`
+}
+
+// configRole describes a role interface of a target, see maker.RoleOptions.
+type configRole struct {
+	Name    string   `yaml:"name"`
+	Comment string   `yaml:"comment"`
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+// configMetrics names the metrics of a target's metrics-output, see
+// maker.MetricsOptions.
+type configMetrics struct {
+	Calls       string `yaml:"calls"`
+	Errors      string `yaml:"errors"`
+	Duration    string `yaml:"duration"`
+	MethodLabel string `yaml:"method-label"`
+	IfaceLabel  string `yaml:"iface-label"`
+}
+
+// config is the content of an ifacemaker config file. Values set in
+// Defaults apply to every target that doesn't set them itself.
+type config struct {
+	Defaults configTarget   `yaml:"defaults"`
+	Targets  []configTarget `yaml:"targets"`
+}
+
+// loadConfig reads a YAML (or JSON) config file.
+func loadConfig(path string) (*config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg config
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(cfg.Targets) == 0 {
+		return nil, fmt.Errorf("%s: no targets defined", path)
+	}
+	return &cfg, nil
+}
+
+func orString(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
+
+func orBool(v, def *bool, fallback bool) bool {
+	if v != nil {
+		return *v
+	}
+	if def != nil {
+		return *def
+	}
+	return fallback
+}
+
+// resolve joins relative paths to the directory of the config file.
+func resolve(baseDir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(baseDir, path)
+}
+
+// target merges the config target with the config defaults and converts it
+// into a target to generate. Relative paths are resolved against baseDir.
+func (t configTarget) target(d configTarget, baseDir string) (target, error) {
+	if len(t.Files) == 0 {
+		t.Files = d.Files
+	}
+	if len(t.ExcludeMethods) == 0 {
+		t.ExcludeMethods = d.ExcludeMethods
+	}
+	if len(t.Include) == 0 {
+		t.Include = d.Include
+	}
+	if len(t.Exclude) == 0 {
+		t.Exclude = d.Exclude
+	}
+	if len(t.Redact) == 0 {
+		t.Redact = d.Redact
+	}
+	if len(t.Roles) == 0 {
+		t.Roles = d.Roles
+	}
+	t.SourceDir = orString(t.SourceDir, d.SourceDir)
+	t.Package = orString(t.Package, d.Package)
+	t.Type = orString(t.Type, d.Type)
+	t.StructType = orString(t.StructType, d.StructType)
+	t.PkgName = orString(t.PkgName, d.PkgName)
+	t.ImportModule = orString(t.ImportModule, d.ImportModule)
+	t.Comment = orString(t.Comment, d.Comment)
+	t.Template = orString(t.Template, d.Template)
+	t.GOOS = orString(t.GOOS, d.GOOS)
+	t.GOARCH = orString(t.GOARCH, d.GOARCH)
+	t.Receiver = orString(t.Receiver, d.Receiver)
+	t.UsedBy = orString(t.UsedBy, d.UsedBy)
+	t.Metrics.Calls = orString(t.Metrics.Calls, d.Metrics.Calls)
+	t.Metrics.Errors = orString(t.Metrics.Errors, d.Metrics.Errors)
+	t.Metrics.Duration = orString(t.Metrics.Duration, d.Metrics.Duration)
+	t.Metrics.MethodLabel = orString(t.Metrics.MethodLabel, d.Metrics.MethodLabel)
+	t.Metrics.IfaceLabel = orString(t.Metrics.IfaceLabel, d.Metrics.IfaceLabel)
+	if t.Workers == 0 {
+		t.Workers = d.Workers
+	}
+	if len(t.Tags) == 0 {
+		t.Tags = d.Tags
+	}
+	if len(t.Platforms) == 0 {
+		t.Platforms = d.Platforms
+	}
+
+	// Targets with roles only are reported under the name of their first
+	// role.
+	name := t.IfaceName
+	if name == "" && len(t.Roles) > 0 {
+		name = t.Roles[0].Name
+	}
+
+	switch {
+	case name == "":
+		return target{}, fmt.Errorf("target has no iface name")
+	case t.PkgName == "":
+		return target{}, fmt.Errorf("target %s: no pkg name", name)
+	case t.Type == "" && len(t.Files) == 0 && t.SourceDir == "" && t.Package == "":
+		return target{}, fmt.Errorf("target %s: one of files, dir, package or type is required", name)
+	case t.Type == "" && t.StructType == "":
+		return target{}, fmt.Errorf("target %s: no struct name", name)
+	case t.Receiver != "" && t.Receiver != "pointer" && t.Receiver != "value":
+		return target{}, fmt.Errorf("target %s: receiver must be pointer or value, not %q", name, t.Receiver)
+	}
+
+	var files []string
+	for _, filePattern := range t.Files {
+		matches, err := filepath.Glob(resolve(baseDir, filePattern))
+		if err != nil {
+			return target{}, fmt.Errorf("target %s: %w", name, err)
+		}
+		files = append(files, matches...)
+	}
+
+	if t.IfaceComment == "" && t.IfaceName != "" {
+		t.IfaceComment = fmt.Sprintf("%s ...", t.IfaceName)
+	}
+
+	var roles []maker.RoleOptions
+	for _, r := range t.Roles {
+		if r.Comment == "" {
+			r.Comment = fmt.Sprintf("%s ...", r.Name)
+		}
+		roles = append(roles, maker.RoleOptions{Name: r.Name, Comment: r.Comment, Include: r.Include, Exclude: r.Exclude})
+	}
+
+	if t.Comment == "" {
+		t.Comment = "Code generated by ifacemaker; DO NOT EDIT."
+	}
+
+	options := maker.MakeOptions{
+		Files:           files,
+		SourceDir:       t.SourceDir,
+		Package:         t.Package,
+		Type:            t.Type,
+		Dir:             baseDir,
+		StructType:      t.StructType,
+		Comment:         t.Comment,
+		PkgName:         t.PkgName,
+		WithPromoted:    orBool(t.WithPromoted, d.WithPromoted, false),
+		EmbedInterfaces: orBool(t.EmbedIfaces, d.EmbedIfaces, false),
+		ValueReceiver:   t.Receiver == "value",
+		IfaceName:       t.IfaceName,
+		IfaceComment:    t.IfaceComment,
+		CopyDocs:        orBool(t.CopyDocs, d.CopyDocs, true),
+		CopyTypeDoc:     orBool(t.CopyTypeDoc, d.CopyTypeDoc, false),
+		ImportModule:    t.ImportModule,
+		ExcludeMethods:  t.ExcludeMethods,
+		Include:         t.Include,
+		Exclude:         t.Exclude,
+		Roles:           roles,
+		WithNotExported: orBool(t.WithNotExported, d.WithNotExported, false),
+		Assert:          orBool(t.Assert, d.Assert, false),
+		UsedBy:          t.UsedBy,
+		Template:        resolve(baseDir, t.Template),
+		Workers:         t.Workers,
+		Build: maker.BuildConfig{
+			Tags:   t.Tags,
+			GOOS:   t.GOOS,
+			GOARCH: t.GOARCH,
+			Tests:  orBool(t.Tests, d.Tests, false),
+		},
+		Metrics:  maker.MetricsOptions(t.Metrics),
+		Redact:   t.Redact,
+		NoRedact: orBool(t.NoRedact, d.NoRedact, false),
+	}
+	return target{
+		options:       options,
+		output:        resolve(baseDir, t.Output),
+		mockOutput:    resolve(baseDir, t.MockOutput),
+		wrapperOutput: resolve(baseDir, t.WrapperOutput),
+		tracedOutput:  resolve(baseDir, t.TracedOutput),
+		metricsOutput: resolve(baseDir, t.MetricsOutput),
+		loggingOutput: resolve(baseDir, t.LoggingOutput),
+		retryOutput:   resolve(baseDir, t.RetryOutput),
+		assertOutput:  resolve(baseDir, t.AssertOutput),
+		platforms:     t.Platforms,
+	}, nil
+}
+
+// runConfig generates every target of the config file at path, see generate.
+func runConfig(path string, check bool) error {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	baseDir := filepath.Dir(path)
+
+	targets := make([]target, len(cfg.Targets))
+	for i, t := range cfg.Targets {
+		targets[i], err = t.target(cfg.Defaults, baseDir)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return generate(targets, check)
+}
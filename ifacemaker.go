@@ -1,25 +1,37 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/vburenin/ifacemaker/maker"
 )
 
 type cmdlineArgs struct {
-	Files           []string `short:"f" long:"file" description:"Go source file to read, either filename or glob" required:"true"`
-	StructType      string   `short:"s" long:"struct" description:"Generate an interface for this structure name" required:"true"`
-	IfaceName       string   `short:"i" long:"iface" description:"Name of the generated interface" required:"true"`
-	PkgName         string   `short:"p" long:"pkg" description:"Package name for the generated interface" required:"true"`
+	Files           []string `short:"f" long:"file" description:"Go source file to read, either filename or glob"`
+	SourceDir       string   `long:"dir" description:"Directory or import path of a package whose Go files are read like the go command does, honoring build constraints, used instead of --file"`
+	Package         string   `long:"package" description:"Go package import pattern to load with full type checking, used instead of --file"`
+	Type            string   `long:"type" description:"Fully qualified type importpath.TypeName to generate an interface for, e.g. database/sql.DB, used instead of --file and --struct"`
+	StructType      string   `short:"s" long:"struct" description:"Generate an interface for this structure name"`
+	IfaceName       string   `short:"i" long:"iface" description:"Name of the generated interface"`
+	PkgName         string   `short:"p" long:"pkg" description:"Package name for the generated interface"`
 	WithPromoted    bool     `short:"P" long:"promoted" description:"Include promoted methods from embedded structs"`
+	EmbedIfaces     bool     `long:"embed-interfaces" description:"With --promoted, embed the interfaces embedded in the struct instead of listing their methods"`
+	Receiver        string   `long:"receiver" description:"Method set the interface matches, the one of a pointer to the struct or of its value" choice:"pointer" choice:"value" default:"pointer"`
 	IfaceComment    string   `short:"y" long:"iface-comment" description:"Comment for the interface, default is '// <iface> ...'"`
 	ImportModule    string   `short:"m" long:"import-module" description:"Fully qualified module import for packages with a different target package '// <iface> ...'"`
 	ExcludeMethods  []string `short:"e" long:"exclude-method" description:"Name of method that will be excluded from output interface"`
+	Include         []string `long:"include" description:"Glob, or regular expression enclosed in slashes, of the names of the methods to include, can be repeated"`
+	Exclude         []string `long:"exclude" description:"Glob, or regular expression enclosed in slashes, of the names of the methods to exclude, can be repeated"`
+	Roles           []string `long:"role" description:"Role interface Name=pattern,!pattern,... made of the methods matching the patterns or whose only directive lists it, can be repeated, --iface then names an interface embedding all roles and is optional"`
 	WithNotExported bool     `short:"x" long:"not-exported" description:"Include not exported methods"`
+	UsedBy          string   `long:"used-by" description:"Go package import pattern of a consumer, only include methods it calls on fields and parameters of the struct type"`
 
 	// jessevdk/go-flags doesn't support default values for boolean flags,
 	// so we use a string for backwards-compatibility and then convert it to a bool later.
@@ -29,6 +41,218 @@ type cmdlineArgs struct {
 	CopyTypeDoc bool   `short:"D" long:"type-doc" description:"Copy type doc from struct"`
 	Comment     string `short:"c" long:"comment" description:"Append comment to top, default is '// Code generated by ifacemaker; DO NOT EDIT.'"`
 	Output      string `short:"o" long:"output" description:"Output file name. If not provided, result will be printed to stdout."`
+	Template    string `long:"template" description:"text/template file used to render the interface instead of the default layout"`
+	MockOutput  string `long:"mock-output" description:"Also generate a gomock compatible mock of the interface into this file"`
+	WrapperOut  string `long:"wrapper-output" description:"Also generate a struct forwarding every method of the interface to another implementation, the base of decorators, into this file"`
+	TracedOut   string `long:"traced-output" description:"Also generate a decorator of the interface recording an OpenTelemetry span around every call into this file"`
+	MetricsOut  string `long:"metrics-output" description:"Also generate a decorator of the interface recording Prometheus metrics of every call into this file"`
+	LoggingOut  string `long:"logging-output" description:"Also generate a decorator of the interface logging every call with log/slog into this file"`
+	RetryOut    string `long:"retry-output" description:"Also generate a decorator of the interface retrying the failed calls of the methods returning an error into this file"`
+	Assert      bool   `long:"assert" description:"Add a compile-time assertion that the struct implements the interface to the output"`
+	AssertOut   string `long:"assert-output" description:"Write a compile-time assertion that the struct implements the interface into this file of the struct's package"`
+
+	MetricsCalls       string `long:"metrics-calls" description:"Name of the counter of calls of --metrics-output, defaults to <iface>_calls_total in snake case"`
+	MetricsErrors      string `long:"metrics-errors" description:"Name of the counter of errors of --metrics-output, defaults to <iface>_errors_total in snake case"`
+	MetricsDuration    string `long:"metrics-duration" description:"Name of the histogram of call durations of --metrics-output, defaults to <iface>_duration_seconds in snake case"`
+	MetricsMethodLabel string `long:"metrics-method-label" description:"Name of the label of the metrics of --metrics-output holding the method name" default:"method"`
+	MetricsIfaceLabel  string `long:"metrics-iface-label" description:"Name of a constant label of the metrics of --metrics-output holding the interface name"`
+
+	Redact   []string `long:"redact" description:"Glob, or regular expression enclosed in slashes, of the names of the parameters whose value --logging-output doesn't log, ignoring case, can be repeated, replaces the default *password*, *token*, *secret*... patterns"`
+	NoRedact bool     `long:"no-redact" description:"Log the values of every parameter with --logging-output"`
+
+	Tags   string `long:"tags" description:"Comma separated list of build tags to consider satisfied with --dir and --package"`
+	GOOS   string `long:"goos" description:"Target operating system for build constraints, defaults to the one of the go command"`
+	GOARCH string `long:"goarch" description:"Target architecture for build constraints, defaults to the one of the go command"`
+	Tests  bool   `long:"tests" description:"Include the _test.go files of the package with --dir and --package"`
+
+	Platforms string `long:"platforms" description:"Comma separated list of GOOS or GOOS/GOARCH platforms, writes a file with a //go:build line per group of platforms when their interfaces differ"`
+
+	Workers int `long:"workers" description:"Maximum number of source files parsed concurrently, defaults to the number of CPUs"`
+
+	Config string `long:"config" description:"YAML or JSON config file describing several interfaces to generate in one run, other flags are ignored"`
+	Check  bool   `long:"check" description:"Don't write the output file, exit with a non-zero status and a diff when it is out of date"`
+}
+
+// errStale is returned, along with the diffs, by a check finding generated
+// files out of date.
+var errStale = errors.New("generated files are out of date")
+
+// fatal reports err and exits with a non-zero status. The diffs of a check
+// are written as they are, other errors are logged.
+func fatal(err error) {
+	if errors.Is(err, errStale) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	log.Fatal(err)
+}
+
+// target is a single interface to generate together with the files that
+// are written for it.
+type target struct {
+	options       maker.MakeOptions
+	output        string
+	mockOutput    string
+	wrapperOutput string
+	tracedOutput  string
+	metricsOutput string
+	loggingOutput string
+	retryOutput   string
+	assertOutput  string
+	// platforms, when set, generates the interface per platform, see
+	// maker.MakePlatforms.
+	platforms []string
+}
+
+// generate generates all targets sharing the parsed sources between them
+// and writes the results. The interface of a target is collected once and
+// all of its files are rendered from it. With check set, the results are compared with
+// the existing files instead, and an error wrapping errStale is returned
+// with their diffs if any of them is out of date.
+func generate(targets []target, check bool) error {
+	g := maker.NewGenerator()
+	var stale []error
+	put := func(t target, output string, result []byte) error {
+		if !check {
+			return writeResult(output, result)
+		}
+		if err := maker.CheckFile(output, t.options.StructType, result); err != nil {
+			stale = append(stale, err)
+		}
+		return nil
+	}
+	emit := func(t target, output string, render func() ([]byte, error)) error {
+		if check && output == "" {
+			return fmt.Errorf("interface %s: --check requires an output file", t.options.IfaceName)
+		}
+		result, err := render()
+		if err != nil {
+			return fmt.Errorf("interface %s: %w", t.options.IfaceName, err)
+		}
+		return put(t, output, result)
+	}
+	warn := func(t target, warnings []string) {
+		for _, w := range warnings {
+			log.Printf("warning: %s: %s", t.options.IfaceName, w)
+		}
+	}
+	for _, t := range targets {
+		if t.output != "" && t.options.PkgPath == "" {
+			// The types of the package the interface is written into
+			// aren't qualified, it's unknown outside of a module.
+			t.options.PkgPath, _ = maker.ImportPathOfDir(filepath.Dir(t.output))
+		}
+		// Code implementing the interface, generated next to it.
+		implementations := []struct {
+			output string
+			render func(*maker.Interface, maker.MakeOptions) ([]byte, error)
+		}{
+			{t.mockOutput, maker.RenderMock},
+			{t.wrapperOutput, maker.RenderWrapper},
+			{t.tracedOutput, maker.RenderTraced},
+			{t.metricsOutput, maker.RenderMetrics},
+			{t.loggingOutput, maker.RenderLogging},
+			{t.retryOutput, maker.RenderRetry},
+		}
+		if len(t.platforms) > 0 {
+			combined := t.assertOutput != ""
+			for _, o := range implementations {
+				combined = combined || o.output != ""
+			}
+			if combined {
+				return fmt.Errorf("interface %s: platforms can't be combined with a mock, decorator or assertion output", t.options.IfaceName)
+			}
+			if check && t.output == "" {
+				return fmt.Errorf("interface %s: --check requires an output file", t.options.IfaceName)
+			}
+			files, err := g.MakePlatforms(t.options, t.platforms)
+			if err != nil {
+				return fmt.Errorf("interface %s: %w", t.options.IfaceName, err)
+			}
+			var warnings []string
+			for _, f := range files {
+				for _, w := range f.Warnings {
+					if !slices.Contains(warnings, w) {
+						warnings = append(warnings, w)
+					}
+				}
+				output := t.output
+				if f.Constraint != "" && output != "" {
+					output = maker.PlatformFileName(output, f.Platforms)
+				}
+				if err := put(t, output, f.Code); err != nil {
+					return err
+				}
+			}
+			warn(t, warnings)
+			continue
+		}
+		iface, err := g.Analyze(t.options)
+		if err != nil {
+			return fmt.Errorf("interface %s: %w", t.options.IfaceName, err)
+		}
+		warn(t, iface.Warnings)
+		if err := emit(t, t.output, func() ([]byte, error) { return maker.Render(iface, t.options) }); err != nil {
+			return err
+		}
+		// Code implementing the interface needs the methods of the
+		// interfaces it embeds, it's collected again without embedding them.
+		implemented := iface
+		for _, o := range implementations {
+			if o.output == "" {
+				continue
+			}
+			if len(implemented.Embeds) > 0 {
+				options := t.options
+				options.EmbedInterfaces = false
+				if implemented, err = g.Analyze(options); err != nil {
+					return fmt.Errorf("interface %s: %w", t.options.IfaceName, err)
+				}
+			}
+			if err := emit(t, o.output, func() ([]byte, error) { return o.render(implemented, t.options) }); err != nil {
+				return err
+			}
+		}
+		if t.assertOutput != "" {
+			renderAssertion := func() ([]byte, error) {
+				if t.output == "" {
+					return nil, fmt.Errorf("--assert-output requires an output file")
+				}
+				ifaceImportPath, err := maker.ImportPathOfDir(filepath.Dir(t.output))
+				if err != nil {
+					return nil, err
+				}
+				return maker.RenderAssertion(iface, ifaceImportPath)
+			}
+			if err := emit(t, t.assertOutput, renderAssertion); err != nil {
+				return err
+			}
+		}
+	}
+	if len(stale) > 0 {
+		return errors.Join(append(stale, errStale)...)
+	}
+	return nil
+}
+
+// writeResult writes the generated code to the output file, or to stdout
+// when output is empty.
+func writeResult(output string, result []byte) (err error) {
+	if output == "" {
+		fmt.Println(string(result))
+		return nil
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	_, err = f.Write(result)
+	return err
 }
 
 func main() {
@@ -42,13 +266,45 @@ func main() {
 		os.Exit(1)
 	}
 
+	if args.Config != "" {
+		if err := runConfig(args.Config, args.Check); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	if args.Type == "" {
+		if len(args.Files) == 0 && args.SourceDir == "" && args.Package == "" {
+			log.Fatal("either --file, --dir, --package or --type must be specified")
+		}
+		if args.StructType == "" {
+			log.Fatal("the required flag `-s, --struct' was not specified")
+		}
+	}
+	if args.IfaceName == "" && len(args.Roles) == 0 {
+		log.Fatal("the required flag `-i, --iface' was not specified")
+	}
+	if args.PkgName == "" {
+		log.Fatal("the required flag `-p, --pkg' was not specified")
+	}
+
 	// Workaround because jessevdk/go-flags doesn't support default values for boolean flags
 	args.copyDocs = args.CopyDocs == "true"
 
-	if args.IfaceComment == "" {
+	if args.IfaceComment == "" && args.IfaceName != "" {
 		args.IfaceComment = fmt.Sprintf("%s ...", args.IfaceName)
 	}
 
+	var roles []maker.RoleOptions
+	for _, r := range args.Roles {
+		role, err := maker.ParseRole(r)
+		if err != nil {
+			log.Fatal(err)
+		}
+		role.Comment = fmt.Sprintf("%s ...", role.Name)
+		roles = append(roles, role)
+	}
+
 	if args.Comment == "" {
 		args.Comment = "Code generated by ifacemaker; DO NOT EDIT."
 	}
@@ -61,38 +317,66 @@ func main() {
 		}
 		files = append(files, matches...)
 	}
-	result, err := maker.Make(maker.MakeOptions{
+	options := maker.MakeOptions{
 		Files:           files,
+		SourceDir:       args.SourceDir,
+		Package:         args.Package,
+		Type:            args.Type,
 		StructType:      args.StructType,
 		Comment:         args.Comment,
 		PkgName:         args.PkgName,
 		WithPromoted:    args.WithPromoted,
+		EmbedInterfaces: args.EmbedIfaces,
+		ValueReceiver:   args.Receiver == "value",
 		IfaceName:       args.IfaceName,
 		IfaceComment:    args.IfaceComment,
 		CopyDocs:        args.copyDocs,
 		CopyTypeDoc:     args.CopyTypeDoc,
 		ImportModule:    args.ImportModule,
 		ExcludeMethods:  args.ExcludeMethods,
+		Include:         args.Include,
+		Exclude:         args.Exclude,
+		Roles:           roles,
 		WithNotExported: args.WithNotExported,
-	})
-	if err != nil {
-		log.Fatal(err.Error())
+		Assert:          args.Assert,
+		UsedBy:          args.UsedBy,
+		Template:        args.Template,
+		Workers:         args.Workers,
+		Build: maker.BuildConfig{
+			Tags:   maker.ParseTags(args.Tags),
+			GOOS:   args.GOOS,
+			GOARCH: args.GOARCH,
+			Tests:  args.Tests,
+		},
+		Metrics: maker.MetricsOptions{
+			Calls:       args.MetricsCalls,
+			Errors:      args.MetricsErrors,
+			Duration:    args.MetricsDuration,
+			MethodLabel: args.MetricsMethodLabel,
+			IfaceLabel:  args.MetricsIfaceLabel,
+		},
+		Redact:   args.Redact,
+		NoRedact: args.NoRedact,
 	}
 
-	if args.Output == "" {
-		fmt.Println(string(result))
-	} else {
-		f, err := os.Create(args.Output)
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer func() {
-			if err := f.Close(); err != nil {
-				log.Fatal(err)
-			}
-		}()
-		if _, err := f.Write(result); err != nil {
-			log.Fatal(err)
-		}
+	var platforms []string
+	if args.Platforms != "" {
+		platforms = strings.Split(args.Platforms, ",")
+	}
+
+	err = generate([]target{{
+		options:       options,
+		output:        args.Output,
+		mockOutput:    args.MockOutput,
+		wrapperOutput: args.WrapperOut,
+		tracedOutput:  args.TracedOut,
+		metricsOutput: args.MetricsOut,
+		loggingOutput: args.LoggingOut,
+		retryOutput:   args.RetryOut,
+		assertOutput:  args.AssertOut,
+		platforms:     platforms,
+	}}, args.Check)
+	if err != nil {
+		fatal(err)
 	}
 }
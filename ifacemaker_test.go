@@ -11,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"github.com/vburenin/ifacemaker/maker"
 )
 
 var testBinary string
@@ -491,6 +492,366 @@ type Test interface {
 	require.Equal(t, expected, out)
 }
 
+func TestMainWithPackage(t *testing.T) {
+	expected := `// Code generated by ifacemaker; DO NOT EDIT.
+
+package gen
+
+// Liner ...
+type Liner interface {
+	// Directive returns the value of the ifacemaker directive name of the
+	// method, e.g. "Reader" for "//ifacemaker:only=Reader", and whether the
+	// method has it. The values of a directive given several times are joined
+	// with commas.
+	Directive(name string) (string, bool)
+	// Lines return a []string consisting of
+	// the documentation and code appended
+	// in chronological order
+	Lines() []string
+}
+
+`
+	os.Args = []string{"cmd", "--package", "./maker", "-s", "Method", "-i", "Liner", "-p", "gen"}
+	out := captureStdout(func() {
+		main()
+	})
+
+	require.Equal(t, expected, out)
+}
+
+func TestMainWithDir(t *testing.T) {
+	os.Args = []string{"cmd", "--dir", "maker", "-s", "ParseError", "-i", "Error", "-p", "gen", "-d=false", "--goos", "windows", "--tags", "a,b"}
+	out := captureStdout(func() {
+		main()
+	})
+
+	require.Contains(t, out, "type Error interface {\n\tError() string\n\tUnwrap() error\n}\n")
+}
+
+func TestMainWithType(t *testing.T) {
+	os.Args = []string{"cmd", "--type", "io.SectionReader", "-i", "SectionReader", "-p", "gen", "-d=false"}
+	out := captureStdout(func() {
+		main()
+	})
+
+	require.Contains(t, out, "type SectionReader interface {")
+	require.Contains(t, out, "\tReadAt(p []byte, off int64) (n int, err error)\n")
+	require.Contains(t, out, "\tOuter() (r io.ReaderAt, off, n int64)\n")
+}
+
+func TestMainNoStruct(t *testing.T) {
+	if os.Getenv("BE_CRASHER_NOSTRUCT") == "1" {
+		os.Args = []string{"cmd", "-f", srcFile, "-i", "Iface", "-p", "gen"}
+		main()
+		return
+	}
+	cmd := exec.Command(testBinary, "-test.run=TestMainNoStruct")
+	cmd.Env = append(os.Environ(), "BE_CRASHER_NOSTRUCT=1")
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok && !exitErr.Success() {
+		return
+	}
+	t.Fatalf("main did not exit as expected")
+}
+
+func TestMainWithConfig(t *testing.T) {
+	dir := t.TempDir()
+	cfg := fmt.Sprintf(`defaults:
+  pkg: gen
+  doc: false
+targets:
+  - files: [%q]
+    struct: Person
+    iface: PersonIface
+    exclude-methods: [SetName, SetAge, SetAgeAndName, SetNameAndTelephone]
+    output: person.go
+  - files: [%q]
+    struct: ChildStruct
+    iface: Child
+    promoted: true
+    doc: true
+    comment: DO NOT EDIT
+    output: child.go
+`, srcFile, srcFile6)
+	cfgPath := filepath.Join(dir, "ifacemaker.yaml")
+	require.NoError(t, os.WriteFile(cfgPath, []byte(cfg), 0o644))
+
+	os.Args = []string{"cmd", "--config", cfgPath}
+	main()
+
+	person, err := os.ReadFile(filepath.Join(dir, "person.go"))
+	require.NoError(t, err)
+	require.Equal(t, `// Code generated by ifacemaker; DO NOT EDIT.
+
+package gen
+
+// PersonIface ...
+type PersonIface interface {
+	Name() string
+	Age() int
+	AgeAndName() (int, string)
+	GetNameAndTelephone() (name, telephone string)
+}
+`, string(person))
+
+	child, err := os.ReadFile(filepath.Join(dir, "child.go"))
+	require.NoError(t, err)
+	require.Equal(t, `// DO NOT EDIT
+
+package gen
+
+// Child ...
+type Child interface {
+	// DoSomething does something
+	DoSomething() error
+}
+`, string(child))
+}
+
+func TestMainWithConfigDefaults(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "store"), os.ModePerm))
+	writeTestSourceFile("module example.com/mod\n", filepath.Join(dir, "go.mod"))
+	writeTestSourceFile(src, filepath.Join(dir, "store", "person.go"))
+	cfg := `defaults:
+  dir: ./store
+  pkg: gen
+  doc: false
+  roles:
+    - name: Namer
+      include: [Name]
+targets:
+  - struct: Person
+    output: person.go
+`
+	cfgPath := filepath.Join(dir, "ifacemaker.yaml")
+	require.NoError(t, os.WriteFile(cfgPath, []byte(cfg), 0o644))
+
+	os.Args = []string{"cmd", "--config", cfgPath}
+	main()
+
+	person, err := os.ReadFile(filepath.Join(dir, "person.go"))
+	require.NoError(t, err)
+	require.Contains(t, string(person), "type Namer interface {\n\tName() string\n}\n")
+}
+
+func TestMainConfigError(t *testing.T) {
+	if os.Getenv("BE_CRASHER_CONFIG") == "1" {
+		cfgPath := filepath.Join(os.TempDir(), "ifacemaker_bad.yaml")
+		writeTestSourceFile("targets:\n  - struct: Person\n", cfgPath)
+		os.Args = []string{"cmd", "--config", cfgPath}
+		main()
+		return
+	}
+	cmd := exec.Command(testBinary, "-test.run=TestMainConfigError")
+	cmd.Env = append(os.Environ(), "BE_CRASHER_CONFIG=1")
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok && !exitErr.Success() {
+		return
+	}
+	t.Fatalf("main did not exit as expected")
+}
+
+func TestMainCheck(t *testing.T) {
+	outPath := filepath.Join(os.TempDir(), "ifacemaker_check.go")
+	args := []string{"cmd", "-f", srcFile, "-s", "Person", "-p", "gen", "-i", "PersonIface", "-o", outPath}
+	if os.Getenv("BE_CRASHER_CHECK") == "1" {
+		writeTestSourceFile("package gen\n", outPath)
+		os.Args = append(args, "--check")
+		main()
+		return
+	}
+
+	os.Args = args
+	main()
+	os.Args = append(args, "--check")
+	main()
+
+	cmd := exec.Command(testBinary, "-test.run=TestMainCheck")
+	cmd.Env = append(os.Environ(), "BE_CRASHER_CHECK=1")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok && !exitErr.Success() {
+		require.Contains(t, stderr.String(), outPath+" is out of date with struct Person")
+		require.Contains(t, stderr.String(), "+type PersonIface interface {")
+		return
+	}
+	t.Fatalf("main did not exit as expected")
+}
+
+func TestGenerateCheck(t *testing.T) {
+	outPath := filepath.Join(t.TempDir(), "iface.go")
+	targets := []target{{
+		options: maker.MakeOptions{Files: []string{srcFile}, StructType: "Person", Comment: "c", PkgName: "gen", IfaceName: "PersonIface"},
+		output:  outPath,
+	}}
+
+	// A stale file is reported to the caller, which decides how to exit.
+	err := generate(targets, true)
+	require.ErrorIs(t, err, errStale)
+	var stale *maker.StaleError
+	require.ErrorAs(t, err, &stale)
+	require.Equal(t, outPath, stale.File)
+
+	require.NoError(t, generate(targets, false))
+	require.NoError(t, generate(targets, true))
+}
+
+func TestGenerateEmbeddedInterfaces(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "svc.go")
+	writeTestSourceFile("package gen\n\nimport \"io\"\n\ntype Svc struct {\n\tio.Closer\n}\n\nfunc (s *Svc) Run() error { return nil }\n", src)
+	err := generate([]target{{
+		options:    maker.MakeOptions{Files: []string{src}, StructType: "Svc", Comment: "c", PkgName: "gen", IfaceName: "Runner", WithPromoted: true, EmbedInterfaces: true},
+		output:     filepath.Join(dir, "iface.go"),
+		mockOutput: filepath.Join(dir, "mock.go"),
+	}}, false)
+	require.NoError(t, err)
+
+	// The interface embeds io.Closer, its mock implements Close.
+	iface, err := os.ReadFile(filepath.Join(dir, "iface.go"))
+	require.NoError(t, err)
+	require.Contains(t, string(iface), "type Runner interface {\n\tio.Closer\n\tRun() error\n}")
+	mock, err := os.ReadFile(filepath.Join(dir, "mock.go"))
+	require.NoError(t, err)
+	require.Contains(t, string(mock), "func (m *MockRunner) Close() error {")
+}
+
+func TestMainWithMockOutput(t *testing.T) {
+	dir := t.TempDir()
+	outPath := filepath.Join(dir, "iface.go")
+	mockPath := filepath.Join(dir, "mock.go")
+	os.Args = []string{"cmd", "-f", srcFile6, "-s", "ChildStruct", "-i", "Child", "-p", "gen", "-P", "-o", outPath, "--mock-output", mockPath}
+	main()
+
+	iface, err := os.ReadFile(outPath)
+	require.NoError(t, err)
+	require.Contains(t, string(iface), "type Child interface {")
+
+	mock, err := os.ReadFile(mockPath)
+	require.NoError(t, err)
+	require.Contains(t, string(mock), "type MockChild struct {")
+	require.Contains(t, string(mock), "func (m *MockChild) DoSomething() error {")
+
+	os.Args = append(os.Args, "--check")
+	main()
+}
+
+func TestMainWithDecoratorOutputs(t *testing.T) {
+	dir := t.TempDir()
+	cfg := fmt.Sprintf(`defaults:
+  pkg: gen
+  metrics:
+    iface-label: iface
+targets:
+  - files: [%q]
+    struct: ChildStruct
+    iface: Child
+    promoted: true
+    output: child.go
+    wrapper-output: child_wrapper.go
+    traced-output: child_traced.go
+    metrics-output: child_metrics.go
+    logging-output: child_logging.go
+    retry-output: child_retry.go
+    metrics:
+      calls: child_calls_total
+`, srcFile6)
+	cfgPath := filepath.Join(dir, "ifacemaker.yaml")
+	require.NoError(t, os.WriteFile(cfgPath, []byte(cfg), 0o644))
+
+	os.Args = []string{"cmd", "--config", cfgPath}
+	main()
+
+	wrapper, err := os.ReadFile(filepath.Join(dir, "child_wrapper.go"))
+	require.NoError(t, err)
+	require.Contains(t, string(wrapper), "func (w ChildWrapper) DoSomething() error {")
+	traced, err := os.ReadFile(filepath.Join(dir, "child_traced.go"))
+	require.NoError(t, err)
+	require.Contains(t, string(traced), "func (t TracedChild) DoSomething() error {")
+	metrics, err := os.ReadFile(filepath.Join(dir, "child_metrics.go"))
+	require.NoError(t, err)
+	require.Contains(t, string(metrics), `Name:        "child_calls_total",`)
+	require.Contains(t, string(metrics), `Name:        "child_errors_total",`)
+	require.Contains(t, string(metrics), `ConstLabels: prometheus.Labels{"iface": "Child"},`)
+	logging, err := os.ReadFile(filepath.Join(dir, "child_logging.go"))
+	require.NoError(t, err)
+	require.Contains(t, string(logging), "func (l LoggingChild) DoSomething() error {")
+	retry, err := os.ReadFile(filepath.Join(dir, "child_retry.go"))
+	require.NoError(t, err)
+	require.Contains(t, string(retry), "func (r RetryChild) DoSomething() error {")
+}
+
+func TestMainWithAssertOutput(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "store"), os.ModePerm))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "gen"), os.ModePerm))
+	writeTestSourceFile("module example.com/mod\n", filepath.Join(dir, "go.mod"))
+	writeTestSourceFile(src6, filepath.Join(dir, "store", "store.go"))
+
+	outPath := filepath.Join(dir, "gen", "iface.go")
+	assertPath := filepath.Join(dir, "store", "assert.go")
+	os.Args = []string{"cmd", "-f", filepath.Join(dir, "store", "store.go"), "-s", "ChildStruct", "-i", "Child", "-p", "gen", "-P", "-o", outPath, "--assert-output", assertPath}
+	main()
+
+	data, err := os.ReadFile(assertPath)
+	require.NoError(t, err)
+	require.Equal(t, `// Code generated by ifacemaker; DO NOT EDIT.
+
+package bazztest
+
+import (
+	"example.com/mod/gen"
+)
+
+var _ gen.Child = (*ChildStruct)(nil)
+`, string(data))
+
+	os.Args = []string{"cmd", "-f", filepath.Join(dir, "store", "store.go"), "-s", "ChildStruct", "-i", "Child", "-p", "gen", "-P", "--assert"}
+	out := captureStdout(func() {
+		main()
+	})
+	require.Contains(t, out, "\tbazztest \"example.com/mod/store\"\n")
+	require.Contains(t, out, "var _ Child = (*bazztest.ChildStruct)(nil)\n")
+}
+
+func TestMainWithPlatforms(t *testing.T) {
+	dir := t.TempDir()
+	writeTestSourceFile("package store\n\ntype Store struct{}\n\nfunc (s *Store) Get() string { return \"\" }\n", filepath.Join(dir, "store.go"))
+	writeTestSourceFile("package store\n\nfunc (s *Store) Fd() int { return 0 }\n", filepath.Join(dir, "store_linux.go"))
+
+	outPath := filepath.Join(dir, "gen", "store.go")
+	require.NoError(t, os.MkdirAll(filepath.Dir(outPath), os.ModePerm))
+	os.Args = []string{"cmd", "--dir", dir, "-s", "Store", "-i", "Store", "-p", "gen", "-o", outPath, "--platforms", "linux,windows/amd64,darwin"}
+	main()
+
+	data, err := os.ReadFile(filepath.Join(dir, "gen", "store.linux.go"))
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(data), "//go:build linux\n\n"))
+	require.Contains(t, string(data), "\tFd() int\n")
+	data, err = os.ReadFile(filepath.Join(dir, "gen", "store.windows_amd64-darwin.go"))
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(data), "//go:build (windows && amd64) || darwin\n\n"))
+	require.NotContains(t, string(data), "Fd()")
+	require.NoFileExists(t, outPath)
+}
+
+func TestMainNoInput(t *testing.T) {
+	if os.Getenv("BE_CRASHER_NOINPUT") == "1" {
+		os.Args = []string{"cmd", "-s", "Person", "-i", "Iface", "-p", "gen"}
+		main()
+		return
+	}
+	cmd := exec.Command(testBinary, "-test.run=TestMainNoInput")
+	cmd.Env = append(os.Environ(), "BE_CRASHER_NOINPUT=1")
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok && !exitErr.Success() {
+		return
+	}
+	t.Fatalf("main did not exit as expected")
+}
+
 func TestMainWriteToFile(t *testing.T) {
 	outPath := filepath.Join(os.TempDir(), "ifacemaker_out.go")
 	if err := os.Remove(outPath); err != nil && !os.IsNotExist(err) {
@@ -0,0 +1,190 @@
+package maker
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// ImportPathOfDir returns the import path of the package in dir. It is
+// derived from the module path declared in the closest go.mod file found
+// in dir or any of its parents.
+func ImportPathOfDir(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for d := abs; ; {
+		data, err := os.ReadFile(filepath.Join(d, "go.mod"))
+		if err == nil {
+			mod := modfile.ModulePath(data)
+			if mod == "" {
+				return "", fmt.Errorf("%s: no module path", filepath.Join(d, "go.mod"))
+			}
+			rel, err := filepath.Rel(d, abs)
+			if err != nil {
+				return "", err
+			}
+			return path.Join(mod, filepath.ToSlash(rel)), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return "", fmt.Errorf("no go.mod found for %s", dir)
+		}
+		d = parent
+	}
+}
+
+// importSpec returns the import declaration of the package named name
+// imported from importPath.
+func importSpec(name, importPath string) string {
+	if name == path.Base(importPath) {
+		return strconv.Quote(importPath)
+	}
+	return fmt.Sprintf("%s %s", name, strconv.Quote(importPath))
+}
+
+// structImportPath returns the import path of the package declaring the
+// source type.
+func (d *Interface) structImportPath() (string, error) {
+	if d.StructPath != "" || d.structPathErr != nil {
+		return d.StructPath, d.structPathErr
+	}
+	return ImportPathOfDir(d.structDir)
+}
+
+// structQualifier returns the qualifier, e.g. "store.", the source type has
+// to be referred to with from the generated package, and the import spec
+// needed for it, if any. Without the import path of the generated package,
+// it's assumed to be the package of the source type when they have the
+// same name.
+func (d *Interface) structQualifier() (qual string, spec string, err error) {
+	if d.importModule != "" || (d.pkgPath == "" && d.PkgName == d.StructPkg) {
+		return "", "", nil
+	}
+	importPath, err := d.structImportPath()
+	if err != nil {
+		return "", "", fmt.Errorf("can't reference %s.%s from package %s: %w", d.StructPkg, d.StructName, d.PkgName, err)
+	}
+	if importPath == d.pkgPath {
+		return "", "", nil
+	}
+	quoted := strconv.Quote(importPath)
+	for _, i := range d.Imports {
+		if i == quoted {
+			return d.StructPkg + ".", "", nil
+		}
+		if name, ok := strings.CutSuffix(i, " "+quoted); ok {
+			return name + ".", "", nil
+		}
+	}
+	return d.StructPkg + ".", importSpec(d.StructPkg, importPath), nil
+}
+
+// needsPointer reports whether a pointer to the source type is needed to
+// implement all of the methods.
+func needsPointer(methods []Method) bool {
+	for _, m := range methods {
+		if m.PointerReceiver {
+			return true
+		}
+	}
+	return false
+}
+
+// assertion returns code asserting at compile time that the source type
+// implements the interface, which it doesn't when a method is renamed.
+// ifaceQual and structQual qualify the interface and the source type, e.g.
+// "store.", or are empty.
+func (d *Interface) assertion(ifaceQual, structQual string) (string, error) {
+	for _, m := range d.Methods {
+		if m.Original != "" {
+			return "", fmt.Errorf("%s can't be asserted to implement the interface, its method %s is renamed to %s", d.StructName, m.Original, m.Name)
+		}
+	}
+	targs, err := typeParamNames(d.TypeParams)
+	if err != nil {
+		return "", err
+	}
+	st := structQual + d.StructName + targs
+	ifaces := []string{d.IfaceName}
+	if d.IfaceName == "" {
+		// Without a composite interface every role is asserted.
+		ifaces = nil
+		for _, r := range d.Roles {
+			ifaces = append(ifaces, r.Name)
+		}
+	}
+
+	var value string
+	switch {
+	case needsPointer(d.Methods):
+		value = fmt.Sprintf("(*%s)(nil)", st)
+	case d.IsStruct:
+		value = st + "{}"
+	default:
+		value = fmt.Sprintf("*new(%s)", st)
+	}
+
+	var vars []string
+	for _, iface := range ifaces {
+		vars = append(vars, fmt.Sprintf("var _ %s%s%s = %s", ifaceQual, iface, targs, value))
+	}
+	if d.TypeParams == "" {
+		return strings.Join(vars, "\n"), nil
+	}
+	// A generic type can only be checked once instantiated. Instantiating it
+	// with its own type parameters inside of a generic function satisfies
+	// any constraint they have.
+	return fmt.Sprintf("func _%s() {\n%s\n}", d.TypeParams, strings.Join(vars, "\n")), nil
+}
+
+// MakeAssertion generates a file for the package declaring the source type
+// that asserts at compile time that the type implements the interface
+// described by options. ifaceImportPath is the import path of the package
+// the interface is generated into, it is empty when the interface is
+// generated into the package of the source type.
+func MakeAssertion(options MakeOptions, ifaceImportPath string) ([]byte, error) {
+	return NewGenerator().MakeAssertion(options, ifaceImportPath)
+}
+
+// MakeAssertion generates a compile-time assertion file, see MakeAssertion.
+func (g *Generator) MakeAssertion(options MakeOptions, ifaceImportPath string) ([]byte, error) {
+	data, err := g.cache.collect(options)
+	if err != nil {
+		return nil, err
+	}
+	return RenderAssertion(data, ifaceImportPath)
+}
+
+// RenderAssertion renders the compile-time assertion file of iface, see
+// MakeAssertion.
+func RenderAssertion(iface *Interface, ifaceImportPath string) ([]byte, error) {
+	var ifaceQual string
+	var imports []string
+	if ifaceImportPath != "" {
+		structPath, err := iface.structImportPath()
+		if err != nil {
+			return nil, err
+		}
+		if ifaceImportPath != structPath {
+			ifaceQual = iface.PkgName + "."
+			imports = append(imports, importSpec(iface.PkgName, ifaceImportPath))
+		}
+	}
+
+	assertion, err := iface.assertion(ifaceQual, "")
+	if err != nil {
+		return nil, err
+	}
+	code := fmt.Sprintf("// %s\n\npackage %s\n\nimport (\n%s\n)\n\n%s\n", iface.Comment, iface.StructPkg, strings.Join(imports, "\n"), assertion)
+	return FormatCode(code)
+}
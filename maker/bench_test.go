@@ -0,0 +1,89 @@
+package maker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeBenchPackage writes a package of n files to a directory of a module
+// in dir. Every file declares a struct embedding the one of the previous
+// file, with a few methods, so that generating an interface for the last
+// struct with promoted methods has to process all of them.
+func writeBenchPackage(tb testing.TB, dir string, n int) []string {
+	tb.Helper()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/bench\n\ngo 1.22\n"), 0o644); err != nil {
+		tb.Fatal(err)
+	}
+	dir = filepath.Join(dir, "internal", "store", "bench")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		tb.Fatal(err)
+	}
+	var files []string
+	for i := range n {
+		var b strings.Builder
+		fmt.Fprintf(&b, "package bench\n\nimport (\n\t\"context\"\n\t\"io\"\n)\n\n")
+		if i == 0 {
+			fmt.Fprintf(&b, "// S%d is a benchmark struct.\ntype S%d struct{}\n\n// Options are options.\ntype Options struct{}\n", i, i)
+		} else {
+			fmt.Fprintf(&b, "// S%d is a benchmark struct.\ntype S%d struct{ S%d }\n", i, i, i-1)
+		}
+		for m := range 10 {
+			fmt.Fprintf(&b, "\n// M%d_%d does something.\nfunc (s *S%d) M%d_%d(ctx context.Context, r io.Reader, n int, o *Options) (int, error) {\n\treturn n, nil\n}\n", i, m, i, i, m)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("s%03d.go", i))
+		if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+			tb.Fatal(err)
+		}
+		files = append(files, path)
+	}
+	return files
+}
+
+func benchmarkMake(b *testing.B, n, workers int) {
+	files := writeBenchPackage(b, b.TempDir(), n)
+	options := MakeOptions{
+		Files:        files,
+		StructType:   fmt.Sprintf("S%d", n-1),
+		Comment:      "c",
+		PkgName:      "bench",
+		IfaceName:    "I",
+		CopyDocs:     true,
+		CopyTypeDoc:  true,
+		WithPromoted: true,
+		Workers:      workers,
+	}
+	b.ResetTimer()
+	for b.Loop() {
+		// A new generator per iteration, so that every file is read and
+		// parsed again. Rendering doesn't depend on Workers, only the
+		// collection of the interface is measured.
+		if _, err := NewGenerator().Analyze(options); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMake_10Files_Sequential(b *testing.B)  { benchmarkMake(b, 10, 1) }
+func BenchmarkMake_10Files_Concurrent(b *testing.B)  { benchmarkMake(b, 10, 0) }
+func BenchmarkMake_100Files_Sequential(b *testing.B) { benchmarkMake(b, 100, 1) }
+func BenchmarkMake_100Files_Concurrent(b *testing.B) { benchmarkMake(b, 100, 0) }
+func BenchmarkMake_500Files_Sequential(b *testing.B) { benchmarkMake(b, 500, 1) }
+func BenchmarkMake_500Files_Concurrent(b *testing.B) { benchmarkMake(b, 500, 0) }
+
+// BenchmarkMake_Cached measures generating several interfaces from the same
+// files with one Generator, where files are only parsed once.
+func BenchmarkMake_Cached(b *testing.B) {
+	files := writeBenchPackage(b, b.TempDir(), 100)
+	g := NewGenerator()
+	b.ResetTimer()
+	for b.Loop() {
+		for _, s := range []string{"S10", "S50", "S99"} {
+			if _, err := g.Make(MakeOptions{Files: files, StructType: s, Comment: "c", PkgName: "bench", IfaceName: "I", WithPromoted: true}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package maker
+
+import (
+	"fmt"
+	"go/build"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// BuildConfig selects the files making up a package the way the go
+// command does, evaluating build constraints and file name suffixes.
+type BuildConfig struct {
+	// Tags are the build tags to consider satisfied.
+	Tags []string
+	// GOOS and GOARCH are the target platform, the one of the go
+	// command is used when they are empty.
+	GOOS   string
+	GOARCH string
+	// Tests includes the _test.go files belonging to the package itself.
+	Tests bool
+}
+
+// constrained reports whether the configuration differs from the default
+// one in the files it selects.
+func (b BuildConfig) constrained() bool {
+	return len(b.Tags) > 0 || b.GOOS != "" || b.GOARCH != ""
+}
+
+// String returns a description of the configuration, used as a cache key.
+func (b BuildConfig) String() string {
+	return fmt.Sprintf("tags=%s goos=%s goarch=%s tests=%t", strings.Join(b.Tags, ","), b.GOOS, b.GOARCH, b.Tests)
+}
+
+// context returns the go/build context matching the configuration, with
+// relative import paths resolved in dir.
+func (b BuildConfig) context(dir string) build.Context {
+	ctx := build.Default
+	ctx.Dir = dir
+	ctx.BuildTags = b.Tags
+	if b.GOOS != "" {
+		ctx.GOOS = b.GOOS
+	}
+	if b.GOARCH != "" {
+		ctx.GOARCH = b.GOARCH
+	}
+	return ctx
+}
+
+// env returns the environment for go/packages, nil for the default one.
+func (b BuildConfig) env() []string {
+	if b.GOOS == "" && b.GOARCH == "" {
+		return nil
+	}
+	env := os.Environ()
+	if b.GOOS != "" {
+		env = append(env, "GOOS="+b.GOOS)
+	}
+	if b.GOARCH != "" {
+		env = append(env, "GOARCH="+b.GOARCH)
+	}
+	return env
+}
+
+// buildFlags returns the flags passed on to the go command by go/packages.
+func (b BuildConfig) buildFlags() []string {
+	if len(b.Tags) == 0 {
+		return nil
+	}
+	return []string{"-tags=" + strings.Join(b.Tags, ",")}
+}
+
+// ParseTags splits a list of build tags separated by commas or spaces, as
+// accepted by the -tags flag of the go command.
+func ParseTags(tags string) []string {
+	return strings.FieldsFunc(tags, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// PackageFiles returns the Go files of the package pkg that are part of
+// the build selected by b, sorted by name. pkg is either a directory or an
+// import path, an existing directory takes precedence. Both are resolved
+// in dir, or in the current working directory when dir is empty.
+func PackageFiles(dir, pkg string, b BuildConfig) ([]string, error) {
+	if dir == "" {
+		var err error
+		if dir, err = os.Getwd(); err != nil {
+			return nil, err
+		}
+	}
+	ctx := b.context(dir)
+
+	var (
+		p   *build.Package
+		err error
+	)
+	path := pkg
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	if fi, statErr := os.Stat(path); statErr == nil && fi.IsDir() {
+		p, err = ctx.ImportDir(path, 0)
+	} else {
+		p, err = ctx.Import(pkg, dir, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := append(p.GoFiles[:len(p.GoFiles):len(p.GoFiles)], p.CgoFiles...)
+	if b.Tests {
+		names = append(names, p.TestGoFiles...)
+	}
+	sort.Strings(names)
+	files := make([]string, len(names))
+	for i, name := range names {
+		files[i] = filepath.Join(p.Dir, name)
+	}
+	return files, nil
+}
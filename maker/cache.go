@@ -0,0 +1,147 @@
+package maker
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// nodeText returns the source code of a node.
+type nodeText func(n ast.Node) string
+
+// srcText returns a nodeText reading src, the source of a file added to
+// its FileSet at base.
+func srcText(src []byte, base int) nodeText {
+	return func(n ast.Node) string {
+		return string(src[int(n.Pos())-base : int(n.End())-base])
+	}
+}
+
+// sourceFile holds a parsed source file together with the results of the
+// first pass over it. Its AST is shared by all passes and must not be
+// modified.
+type sourceFile struct {
+	name           string
+	src            []byte
+	fset           *token.FileSet
+	file           *ast.File
+	text           nodeText
+	declaredTypes  []declaredType
+	embeddingGraph map[string][]string
+}
+
+// parseSourceFile parses src, the content of the file filename, into fset
+// and runs the first pass over it. A *ParseError is returned if src can't
+// be parsed.
+func parseSourceFile(fset *token.FileSet, filename string, src []byte) (*sourceFile, error) {
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, newParseError(filename, "", err)
+	}
+	return &sourceFile{
+		name:           filename,
+		src:            src,
+		fset:           fset,
+		file:           file,
+		text:           srcText(src, int(file.FileStart)),
+		declaredTypes:  declaredTypesOf(file),
+		embeddingGraph: embeddingGraphOf(file),
+	}, nil
+}
+
+// sourceCache keeps the source files and packages loaded while generating
+// interfaces, so that several targets generated in one run read and parse
+// every input only once. All files share one FileSet.
+type sourceCache struct {
+	fset *token.FileSet
+
+	mu       sync.Mutex // guards files, packages and comments
+	files    map[string]*sourceFile
+	packages map[string]*packages.Package
+	// comments are the doc comments of the methods of the loaded
+	// packages, see methodComments.
+	comments map[*packages.Package]map[string]*ast.CommentGroup
+}
+
+func newSourceCache() *sourceCache {
+	return &sourceCache{
+		fset:     token.NewFileSet(),
+		files:    make(map[string]*sourceFile),
+		packages: make(map[string]*packages.Package),
+		comments: make(map[*packages.Package]map[string]*ast.CommentGroup),
+	}
+}
+
+// file returns the cached source file at path, reading and parsing it on
+// first use. It is safe for concurrent use.
+func (c *sourceCache) file(path string) (*sourceFile, error) {
+	key, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	sf, ok := c.files[key]
+	c.mu.Unlock()
+	if ok {
+		return sf, nil
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if sf, err = parseSourceFile(c.fset, path, src); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Keep the file parsed first if it was loaded concurrently.
+	if cached, ok := c.files[key]; ok {
+		return cached, nil
+	}
+	c.files[key] = sf
+	return sf, nil
+}
+
+// loadFiles returns the source files at paths, in order, reading and
+// parsing up to workers of them concurrently.
+func (c *sourceCache) loadFiles(paths []string, workers int) ([]*sourceFile, error) {
+	files := make([]*sourceFile, len(paths))
+	err := parallel(len(paths), workers, func(i int) (err error) {
+		files[i], err = c.file(paths[i])
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// loadPackage returns the cached package matching pattern in dir with the
+// build configuration b, loading it on first use. It is safe for
+// concurrent use.
+func (c *sourceCache) loadPackage(dir, pattern string, b BuildConfig) (*packages.Package, error) {
+	key := dir + "\x00" + pattern + "\x00" + b.String()
+	c.mu.Lock()
+	pkg, ok := c.packages[key]
+	c.mu.Unlock()
+	if ok {
+		return pkg, nil
+	}
+	pkg, err := LoadPackageFor(dir, pattern, b)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Keep the package loaded first if it was loaded concurrently.
+	if cached, ok := c.packages[key]; ok {
+		return cached, nil
+	}
+	c.packages[key] = pkg
+	return pkg, nil
+}
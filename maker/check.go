@@ -0,0 +1,77 @@
+package maker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// StaleError is returned by Check when a generated file on disk differs
+// from the code generated for its struct.
+type StaleError struct {
+	// File is the path of the stale file.
+	File string
+	// Struct is the name of the struct the interface is generated for.
+	Struct string
+	// Diff is a unified diff from the content of File to the generated code.
+	Diff string
+}
+
+// Error implements the error interface.
+func (e *StaleError) Error() string {
+	return fmt.Sprintf("%s is out of date with struct %s:\n%s", e.File, e.Struct, e.Diff)
+}
+
+// Check generates the interface described by options in memory and
+// compares it with the content of the file at path. It returns a
+// *StaleError holding a unified diff when they differ.
+func Check(options MakeOptions, path string) error {
+	return CheckAll([]MakeOptions{options}, []string{path})
+}
+
+// CheckAll runs Check for every options and path pair, sharing source files
+// and packages between the targets like MakeAll does. All stale files are
+// reported in the returned error.
+func CheckAll(options []MakeOptions, paths []string) error {
+	if len(options) != len(paths) {
+		return fmt.Errorf("got %d targets but %d paths", len(options), len(paths))
+	}
+	results, err := MakeAll(options)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i, result := range results {
+		if err := CheckFile(paths[i], options[i].StructType, result); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CheckFile compares the code generated for structName with the content of
+// the file at path and returns a *StaleError when they differ. A missing
+// file is treated as empty.
+func CheckFile(path, structName string, generated []byte) error {
+	current, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if bytes.Equal(current, generated) {
+		return nil
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(current)),
+		B:        difflib.SplitLines(string(generated)),
+		FromFile: path,
+		ToFile:   path + " (generated)",
+		Context:  3,
+	})
+	if err != nil {
+		return err
+	}
+	return &StaleError{File: path, Struct: structName, Diff: diff}
+}
@@ -0,0 +1,205 @@
+package maker
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// writeHeader writes the header comment, package clause and imports of a
+// file generated next to iface, with the additional imports extra.
+func writeHeader(b *strings.Builder, iface *Interface, extra []string) {
+	fmt.Fprintf(b, "// %s\n\npackage %s\n\nimport (\n", iface.Comment, iface.PkgName)
+	for _, i := range iface.Imports {
+		b.WriteString(i + "\n")
+	}
+	for _, i := range extra {
+		if !slices.Contains(iface.Imports, i) {
+			b.WriteString(i + "\n")
+		}
+	}
+	b.WriteString(")\n\n")
+}
+
+// writeImplements writes a compile-time assertion that value implements
+// iface.
+func writeImplements(b *strings.Builder, iface *Interface, value string) {
+	targs, _ := typeParamNames(iface.TypeParams)
+	if iface.TypeParams == "" {
+		fmt.Fprintf(b, "\nvar _ %s = %s\n", iface.IfaceName, value)
+		return
+	}
+	fmt.Fprintf(b, "\nfunc _%s() {\nvar _ %s%s = %s\n}\n", iface.TypeParams, iface.IfaceName, targs, value)
+}
+
+// memberName returns name, followed by as many underscores as needed for
+// it not to be the name of a method of iface, to name the fields and helper
+// methods of a type implementing iface.
+func memberName(iface *Interface, name string) string {
+	for slices.ContainsFunc(iface.Methods, func(m Method) bool { return m.Name == name }) {
+		name += "_"
+	}
+	return name
+}
+
+// decoratorImports hands out the local names of the packages used by the
+// code of a decorator of an interface, reusing the imports of the
+// interface and aliasing the ones whose name is already taken.
+type decoratorImports struct {
+	iface *Interface
+	specs []string
+	names []string
+}
+
+// use returns the local name of the package at importPath, importing it
+// if needed.
+func (i *decoratorImports) use(importPath string) string {
+	quoted := strconv.Quote(importPath)
+	for _, spec := range append(slices.Clone(i.iface.Imports), i.specs...) {
+		alias, q := cutSpec(spec)
+		if q != quoted {
+			continue
+		}
+		if alias == "" {
+			alias = importName(importPath)
+		}
+		i.names = append(i.names, alias)
+		return alias
+	}
+	base := importName(importPath)
+	name := base
+	for n := 2; importPathOf(i.iface.Imports, name) != "" || importPathOf(i.specs, name) != ""; n++ {
+		name = base + strconv.Itoa(n)
+	}
+	spec := quoted
+	if name != base {
+		spec = name + " " + quoted
+	}
+	i.specs = append(i.specs, spec)
+	i.names = append(i.names, name)
+	return name
+}
+
+// decoratedMethod helps generating a method of a type implementing the
+// interface by calling the same method of another implementation. Its
+// parameters are named so that they can be passed on, and the names
+// declared in the method are kept apart from them and from the imports.
+type decoratedMethod struct {
+	Method
+	// params are the parameters of the method, unnamed and blank ones and
+	// the ones shadowing an import are named argN.
+	params []Param
+	names  map[string]bool
+}
+
+// newDecoratedMethod prepares the generation of m in a file importing
+// the packages named pkgNames.
+func newDecoratedMethod(m Method, pkgNames []string) *decoratedMethod {
+	d := &decoratedMethod{Method: m, params: slices.Clone(m.Params), names: make(map[string]bool)}
+	for _, n := range pkgNames {
+		d.names[n] = true
+	}
+	for i, p := range d.params {
+		if d.names[p.Name] || p.Name == "" || p.Name == "_" {
+			d.params[i].Name = fmt.Sprintf("arg%d", i)
+		}
+		d.names[d.params[i].Name] = true
+	}
+	return d
+}
+
+// declare returns name, or a variation of it, that isn't declared in the
+// method yet, and declares it.
+func (d *decoratedMethod) declare(name string) string {
+	for d.names[name] {
+		name += "_"
+	}
+	d.names[name] = true
+	return name
+}
+
+// signature formats the declaration of the method with the receiver recv
+// of type typ, up to the opening brace.
+func (d *decoratedMethod) signature(recv, typ string) string {
+	return fmt.Sprintf("func (%s %s) %s(%s)%s {\n", recv, typ, d.Name, paramList(d.params), resultList(d.Results))
+}
+
+// call formats the call of the method on next passing on the parameters.
+func (d *decoratedMethod) call(next string) string {
+	return fmt.Sprintf("%s.%s(%s)", next, d.Name, argList(d.params))
+}
+
+// context returns the name of the leading context.Context parameter of
+// the method, or an empty string if it has none.
+func (d *decoratedMethod) context() string {
+	if len(d.params) == 0 {
+		return ""
+	}
+	p := d.params[0]
+	if p.PkgPath != "context" || p.Variadic || !strings.HasSuffix(p.Type, ".Context") {
+		return ""
+	}
+	return p.Name
+}
+
+// returnsError reports whether the last result of the method is an error.
+func (d *decoratedMethod) returnsError() bool {
+	return len(d.Results) > 0 && d.Results[len(d.Results)-1].Type == "error"
+}
+
+// resultVars declares a variable for every result of the method, err for
+// a trailing error and rN for the others.
+func (d *decoratedMethod) resultVars() []string {
+	vars := make([]string, len(d.Results))
+	for i := range d.Results {
+		if i == len(d.Results)-1 && d.returnsError() {
+			vars[i] = d.declare("err")
+		} else {
+			vars[i] = d.declare(fmt.Sprintf("r%d", i))
+		}
+	}
+	return vars
+}
+
+// paramList formats params as a parameter list, e.g. "id int, opts ...string".
+func paramList(params []Param) string {
+	parts := make([]string, len(params))
+	for i, p := range params {
+		if p.Variadic {
+			parts[i] = p.Name + " ..." + p.Type
+		} else {
+			parts[i] = p.Name + " " + p.Type
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// argList formats the arguments passing params on, e.g. "id, opts...".
+func argList(params []Param) string {
+	parts := make([]string, len(params))
+	for i, p := range params {
+		parts[i] = p.Name
+		if p.Variadic {
+			parts[i] += "..."
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// resultList formats the types of results as the result list of a
+// function, e.g. " (int, error)", or returns an empty string if there are
+// no results.
+func resultList(results []Param) string {
+	switch len(results) {
+	case 0:
+		return ""
+	case 1:
+		return " " + results[0].Type
+	}
+	types := make([]string, len(results))
+	for i, r := range results {
+		types[i] = r.Type
+	}
+	return " (" + strings.Join(types, ", ") + ")"
+}
@@ -0,0 +1,112 @@
+package maker
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"slices"
+	"strings"
+)
+
+// directivePrefix starts the lines of the doc comment of a method that
+// control how it's generated:
+//
+//	//ifacemaker:exclude              leaves the method out of every interface
+//	//ifacemaker:only=Reader,Writer   only adds it to the interfaces named Reader or Writer
+//	//ifacemaker:rename=Fetch         names the method Fetch in the interface
+//	//ifacemaker:nolog                doesn't log the calls of the method in logging decorators
+//
+// They are never copied into the generated docs.
+const directivePrefix = "//ifacemaker:"
+
+// isDirective reports whether the comment line is a go or an ifacemaker
+// directive.
+func isDirective(line string) bool {
+	return reMatchDirective.MatchString(line) || strings.HasPrefix(line, directivePrefix)
+}
+
+// methodDirectives returns the ifacemaker directives of the doc comment
+// doc without their prefix, e.g. "only=Reader".
+func methodDirectives(doc *ast.CommentGroup) []string {
+	if doc == nil {
+		return nil
+	}
+	var directives []string
+	for _, c := range doc.List {
+		if d, ok := strings.CutPrefix(c.Text, directivePrefix); ok {
+			directives = append(directives, strings.TrimSpace(d))
+		}
+	}
+	return directives
+}
+
+// Directive returns the value of the ifacemaker directive name of the
+// method, e.g. "Reader" for "//ifacemaker:only=Reader", and whether the
+// method has it. The values of a directive given several times are joined
+// with commas.
+func (m *Method) Directive(name string) (string, bool) {
+	var (
+		values []string
+		found  bool
+	)
+	for _, d := range m.Directives {
+		key, value, _ := strings.Cut(d, "=")
+		if key == name {
+			found = true
+			if value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return strings.Join(values, ","), found
+}
+
+// renameDoc returns the doc comment lines docs of a method renamed from
+// old to name, with the leading method name of the first line renamed as
+// well, e.g. "// Load fetches a value." for "// Fetch fetches a value.".
+func renameDoc(docs []string, old, name string) []string {
+	if len(docs) == 0 {
+		return docs
+	}
+	prefix := "// " + old
+	rest, ok := strings.CutPrefix(docs[0], prefix)
+	if !ok || (rest != "" && !strings.HasPrefix(rest, " ") && !strings.HasPrefix(rest, ".") && !strings.HasPrefix(rest, ",")) {
+		return docs
+	}
+	docs = slices.Clone(docs)
+	docs[0] = "// " + name + rest
+	return docs
+}
+
+// applyDirectives removes the methods of data excluded by their directives
+// from the interface options.IfaceName, and renames the ones asking for
+// it. With roles, only directives are left to splitRoles.
+func applyDirectives(data *Interface, options MakeOptions) error {
+	ifaceName := options.IfaceName
+	var methods []Method
+	names := make(map[string]struct{})
+	for _, m := range data.Methods {
+		if _, ok := m.Directive("exclude"); ok {
+			continue
+		}
+		if only, ok := m.Directive("only"); ok && len(options.Roles) == 0 && !slices.Contains(strings.Split(only, ","), ifaceName) {
+			continue
+		}
+		if name, ok := m.Directive("rename"); ok {
+			if !token.IsIdentifier(name) {
+				return fmt.Errorf("method %s: invalid rename directive %q", m.Name, name)
+			}
+			m.Original = m.Name
+			m.Code = name + strings.TrimPrefix(m.Code, m.Name)
+			m.Docs = renameDoc(m.Docs, m.Name, name)
+			m.Name = name
+		}
+		if _, dup := names[m.Name]; dup {
+			return fmt.Errorf("method %s: duplicate method name in %s", m.Name, ifaceName)
+		}
+		names[m.Name] = struct{}{}
+		methods = append(methods, m)
+	}
+	data.Methods = methods
+	return nil
+}
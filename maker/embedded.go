@@ -0,0 +1,619 @@
+package maker
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// embeddedType is a field of a struct, or an element of an interface,
+// embedding a named type, e.g. Logger, sync.Mutex or *base.Repo, found in
+// a source file. pkgName is empty for types of the same package.
+type embeddedType struct {
+	file     *sourceFile
+	expr     ast.Expr
+	pkgName  string
+	typeName string
+	pointer  bool
+	generic  bool
+}
+
+// String returns the qualified name of the type, e.g. "sync.Mutex".
+func (e embeddedType) String() string {
+	if e.pkgName == "" {
+		return e.typeName
+	}
+	return e.pkgName + "." + e.typeName
+}
+
+// embeddedFields returns the embedded named types of the fields of fl.
+func (sf *sourceFile) embeddedFields(fl *ast.FieldList) []embeddedType {
+	var embeds []embeddedType
+	for _, field := range fl.List {
+		if len(field.Names) > 0 {
+			continue
+		}
+		e := embeddedType{file: sf, expr: field.Type}
+		expr := field.Type
+		if star, ok := expr.(*ast.StarExpr); ok {
+			e.pointer = true
+			expr = star.X
+		}
+		switch x := expr.(type) {
+		case *ast.IndexExpr:
+			e.generic, expr = true, x.X
+		case *ast.IndexListExpr:
+			e.generic, expr = true, x.X
+		}
+		switch x := expr.(type) {
+		case *ast.Ident:
+			e.typeName = x.Name
+		case *ast.SelectorExpr:
+			pkg, ok := x.X.(*ast.Ident)
+			if !ok {
+				continue
+			}
+			e.pkgName, e.typeName = pkg.Name, x.Sel.Name
+		default:
+			continue
+		}
+		embeds = append(embeds, e)
+	}
+	return embeds
+}
+
+// typeDecl is a type declared in a source file.
+type typeDecl struct {
+	file *sourceFile
+	spec *ast.TypeSpec
+}
+
+// typeDecls returns the types declared in files by name.
+func typeDecls(files []*sourceFile) map[string]typeDecl {
+	decls := make(map[string]typeDecl)
+	for _, sf := range files {
+		ast.Inspect(sf.file, func(n ast.Node) bool {
+			ts, ok := n.(*ast.TypeSpec)
+			if !ok {
+				return true
+			}
+			if _, dup := decls[ts.Name.Name]; !dup {
+				decls[ts.Name.Name] = typeDecl{file: sf, spec: ts}
+			}
+			return false
+		})
+	}
+	return decls
+}
+
+// localMethod is a method declared for the local type recv.
+type localMethod struct {
+	recv string
+	Method
+}
+
+// receiverMethods returns the methods declared in sf for the types named
+// in names in declaration order.
+func receiverMethods(sf *sourceFile, names map[string]struct{}, options MakeOptions, declaredTypes []declaredType) []localMethod {
+	var methods []localMethod
+	for _, d := range sf.file.Decls {
+		recv, fd := getReceiverTypeName(sf.text, d)
+		if _, ok := names[recv]; !ok || fd == nil {
+			continue
+		}
+		if !options.WithNotExported && !fd.Name.IsExported() {
+			continue
+		}
+		var docs []string
+		if options.CopyDocs {
+			docs = docLines(sf.text, fd.Doc)
+		}
+		methods = append(methods, localMethod{recv: recv, Method: Method{
+			Name:            fd.Name.Name,
+			Code:            formatMethod(sf.text, fd.Name.Name, fd.Type, options.PkgName, declaredTypes),
+			Docs:            docs,
+			PointerReceiver: isPointerReceiver(fd),
+			Directives:      methodDirectives(fd.Doc),
+		}})
+	}
+	return methods
+}
+
+// promoter resolves the methods promoted to a struct in file mode the way
+// the Go spec defines selectors: a method is promoted from the shallowest
+// depth of embedding it's found at, unless another method or field of the
+// same name is found at that depth too. Methods with a pointer receiver
+// are only in the method set of the struct value when they're promoted
+// through an embedded pointer.
+type promoter struct {
+	c             *sourceCache
+	options       MakeOptions
+	declaredTypes []declaredType
+	decls         map[string]typeDecl
+	// locals are the methods of the local embedded types in source order.
+	locals []localMethod
+	// receivers indexes locals by receiver type.
+	receivers map[string][]int
+	// visiting guards against invalid interfaces embedding themselves.
+	visiting map[string]struct{}
+	qf       types.Qualifier
+	// warnings report the embedded types of other packages that couldn't
+	// be loaded, whose methods aren't promoted.
+	warnings []string
+}
+
+// newPromoter returns a promoter of the methods of the local types in
+// locals. imports lists the imports already used by the interface, the
+// types of other packages are qualified for its package.
+func (c *sourceCache) newPromoter(files []*sourceFile, locals []localMethod, declaredTypes []declaredType, options MakeOptions, imports []string) (*promoter, *importTracker) {
+	it := newImportTracker()
+	for _, spec := range imports {
+		it.reserve(spec)
+	}
+	p := &promoter{
+		c:             c,
+		options:       options,
+		declaredTypes: declaredTypes,
+		decls:         typeDecls(files),
+		locals:        locals,
+		receivers:     make(map[string][]int),
+		visiting:      make(map[string]struct{}),
+		qf:            it.qualifier(nil, options.PkgName, options.PkgPath, options.ImportModule),
+	}
+	for i, m := range locals {
+		p.receivers[m.recv] = append(p.receivers[m.recv], i)
+	}
+	return p, it
+}
+
+// embedding is an occurrence of an embedded type at some depth of the
+// struct.
+type embedding struct {
+	embeddedType
+	depth int
+	// indirect is set when the type is reached through an embedded pointer.
+	indirect bool
+	iface    bool
+}
+
+// selector is a method or a field, named name, of an embedded type.
+type selector struct {
+	name   string
+	method *Method
+	// pointer is set for methods that are only in the method set of a
+	// pointer to the struct.
+	pointer bool
+	depth   int
+	from    *embedding
+	// order keeps the methods of local types first, in source order.
+	order int
+}
+
+// ambiguousSelector formats the warning about the selector root.name that
+// isn't promoted because the embedded types from have it at the same depth.
+func ambiguousSelector(root, name string, from []string) string {
+	return fmt.Sprintf("ambiguous selector %s.%s is not promoted, it's found in %s at the same depth", root, name, strings.Join(from, " and "))
+}
+
+// promoted returns the methods promoted to the struct root, whose own
+// methods are direct, from the types it embeds: local types, interfaces
+// and types of other packages, which are loaded with type information.
+// With options.EmbedInterfaces, the interfaces whose methods are all
+// promoted are returned as embeds instead. Ambiguous selectors, which
+// aren't promoted, are reported in warnings.
+func (p *promoter) promoted(root string, direct []Method) (methods []Method, embeds []string, warnings []string, err error) {
+	rootDecl, ok := p.decls[root]
+	if !ok {
+		return nil, nil, nil, nil
+	}
+	shallow := make(map[string]*Method)
+	for i := range direct {
+		shallow[direct[i].Name] = &direct[i]
+	}
+
+	var sels []selector
+	add := func(sel selector) {
+		if sel.order == 0 {
+			sel.order = len(p.locals) + 1 + len(sels)
+		}
+		sels = append(sels, sel)
+	}
+	queue := p.fields(rootDecl, &embedding{}, func(name string) {
+		if _, ok := shallow[name]; !ok {
+			shallow[name] = nil
+		}
+	})
+	seen := map[string]int{root: 0}
+	for len(queue) > 0 {
+		e := queue[0]
+		queue = queue[1:]
+		key := e.typeName
+		if e.pkgName != "" {
+			importPath, _ := p.importPath(e.file, e.pkgName)
+			if importPath == "" {
+				importPath = e.pkgName
+			}
+			key = importPath + "." + e.typeName
+		}
+		// A type found again deeper is shadowed by itself.
+		if d, ok := seen[key]; ok && d < e.depth {
+			continue
+		}
+		seen[key] = e.depth
+
+		if e.pkgName != "" {
+			if err := p.external(e, add); err != nil {
+				return nil, nil, nil, err
+			}
+			continue
+		}
+		decl, ok := p.decls[e.typeName]
+		if !ok {
+			// Declared in a file that isn't read.
+			continue
+		}
+		if _, ok := decl.spec.Type.(*ast.InterfaceType); ok {
+			if e.generic {
+				return nil, nil, nil, newParseError(e.file.name, p.options.StructType, fmt.Errorf("promoting methods of generic interface %s is not supported", e))
+			}
+			e.iface = true
+			ms, err := p.interfaceMethods(decl)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			for i := range ms {
+				add(selector{name: ms[i].Name, method: &ms[i], depth: e.depth, from: e})
+			}
+			continue
+		}
+		for _, i := range p.receivers[e.typeName] {
+			m := &p.locals[i].Method
+			add(selector{name: m.Name, method: m, pointer: m.PointerReceiver && !e.indirect, depth: e.depth, from: e, order: i + 1})
+		}
+		queue = append(queue, p.fields(decl, e, func(name string) {
+			add(selector{name: name, depth: e.depth, from: e})
+		})...)
+	}
+
+	// The selectors found at the smallest depth win, if there's only one
+	// of them.
+	byName := make(map[string][]selector)
+	var names []string
+	for _, sel := range sels {
+		if _, ok := byName[sel.name]; !ok {
+			names = append(names, sel.name)
+		}
+		byName[sel.name] = append(byName[sel.name], sel)
+	}
+	var winners []selector
+	for _, name := range names {
+		if _, ok := shallow[name]; ok {
+			continue
+		}
+		found := shallowest(byName[name])
+		if len(found) > 1 {
+			var from []string
+			hasMethod := false
+			for _, sel := range found {
+				from = append(from, sel.from.String())
+				hasMethod = hasMethod || sel.method != nil
+			}
+			if hasMethod {
+				warnings = append(warnings, ambiguousSelector(root, name, from))
+			}
+			continue
+		}
+		if found[0].method != nil {
+			winners = append(winners, found[0])
+		}
+	}
+
+	// Interfaces are embedded when all their methods are promoted, or are
+	// shadowed by an identical method of the struct.
+	embedded := make(map[*embedding]bool)
+	if p.options.EmbedInterfaces {
+		for _, sel := range sels {
+			if sel.from.iface {
+				embedded[sel.from] = true
+			}
+		}
+		for _, sel := range sels {
+			if !sel.from.iface {
+				continue
+			}
+			if m := shallow[sel.name]; m != nil && m.Code == sel.method.Code {
+				continue
+			}
+			if !slices.ContainsFunc(winners, func(w selector) bool { return w.from == sel.from && w.name == sel.name }) {
+				embedded[sel.from] = false
+			}
+		}
+		for _, sel := range sels {
+			if e := sel.from; embedded[e] {
+				ref := formatFieldList(e.file.text, &ast.FieldList{List: []*ast.Field{{Type: e.expr}}}, p.options.PkgName, p.declaredTypes)[0]
+				if !slices.Contains(embeds, ref) {
+					embeds = append(embeds, ref)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(winners, func(i, j int) bool {
+		return winners[i].order < winners[j].order
+	})
+	for _, sel := range winners {
+		if embedded[sel.from] {
+			continue
+		}
+		m := *sel.method
+		m.PointerReceiver = sel.pointer
+		methods = append(methods, m)
+	}
+	return methods, embeds, append(p.warnings, warnings...), nil
+}
+
+// shallowest returns the selectors of sels found at the smallest depth.
+func shallowest(sels []selector) []selector {
+	var found []selector
+	for _, sel := range sels {
+		if len(found) > 0 && sel.depth > found[0].depth {
+			continue
+		}
+		if len(found) > 0 && sel.depth < found[0].depth {
+			found = found[:0]
+		}
+		found = append(found, sel)
+	}
+	return found
+}
+
+// fields reports the names of the fields of the struct decl, embedded in
+// parent, to field, and returns the types it embeds.
+func (p *promoter) fields(decl typeDecl, parent *embedding, field func(name string)) []*embedding {
+	st, ok := decl.spec.Type.(*ast.StructType)
+	if !ok {
+		return nil
+	}
+	for _, f := range st.Fields.List {
+		for _, n := range f.Names {
+			field(n.Name)
+		}
+	}
+	var embedded []*embedding
+	for _, e := range decl.file.embeddedFields(st.Fields) {
+		field(e.typeName)
+		embedded = append(embedded, &embedding{
+			embeddedType: e,
+			depth:        parent.depth + 1,
+			indirect:     parent.indirect || e.pointer,
+		})
+	}
+	return embedded
+}
+
+// external adds the methods and fields of the type of another package
+// embedded by e, at the depth they're found at.
+func (p *promoter) external(e *embedding, add func(selector)) error {
+	pkg, obj, err := p.lookup(e.embeddedType)
+	if err != nil || pkg == nil {
+		return err
+	}
+	t := obj.Type()
+	e.iface = types.IsInterface(t)
+	if e.generic && !(e.iface && p.options.EmbedInterfaces) {
+		return newParseError(e.file.name, p.options.StructType, fmt.Errorf("promoting methods of generic type %s of another package is not supported", e))
+	}
+	if st, ok := t.Underlying().(*types.Struct); ok {
+		for i := 0; i < st.NumFields(); i++ {
+			if f := st.Field(i); f.Exported() {
+				add(selector{name: f.Name(), depth: e.depth, from: e})
+			}
+		}
+	}
+	if !e.iface {
+		t = types.NewPointer(t)
+	}
+	mset := types.NewMethodSet(t)
+	// Methods missing from the method set of the value type require a
+	// pointer to the struct, unless they're reached through a pointer.
+	valueSet := types.NewMethodSet(obj.Type())
+	var sels []*types.Selection
+	for i := 0; i < mset.Len(); i++ {
+		if sel := mset.At(i); sel.Obj().Exported() {
+			sels = append(sels, sel)
+		}
+	}
+	// The methods of the type come first, then the ones it promotes, by
+	// depth.
+	sort.SliceStable(sels, func(i, j int) bool {
+		if len(sels[i].Index()) != len(sels[j].Index()) {
+			return len(sels[i].Index()) < len(sels[j].Index())
+		}
+		return positionLess(pkg.Fset, sels[i].Obj().Pos(), sels[j].Obj().Pos())
+	})
+
+	for _, sel := range sels {
+		fn := sel.Obj().(*types.Func)
+		doc := p.c.methodComment(pkg, fn, filepath.Dir(e.file.name), p.options.Build)
+		var docs []string
+		if p.options.CopyDocs {
+			docs = methodDocs(doc)
+		}
+		sig := fn.Type().(*types.Signature)
+		add(selector{
+			name: fn.Name(),
+			method: &Method{
+				Name:       fn.Name(),
+				Code:       FormatSignature(fn.Name(), sig, p.qf),
+				Docs:       docs,
+				Directives: methodDirectives(doc),
+			},
+			pointer: !e.indirect && valueSet.Lookup(fn.Pkg(), fn.Name()) == nil,
+			depth:   e.depth + len(sel.Index()) - 1,
+			from:    e,
+		})
+	}
+	return nil
+}
+
+// interfaceMethods returns the methods of a local interface, including the
+// ones of the interfaces it embeds, in declaration order.
+func (p *promoter) interfaceMethods(decl typeDecl) ([]Method, error) {
+	name := decl.spec.Name.Name
+	if _, ok := p.visiting[name]; ok {
+		return nil, nil
+	}
+	p.visiting[name] = struct{}{}
+	defer delete(p.visiting, name)
+
+	sf := decl.file
+	var methods []Method
+	for _, field := range decl.spec.Type.(*ast.InterfaceType).Methods.List {
+		if len(field.Names) == 0 {
+			embedded, err := p.interfaceEmbeds(sf, field)
+			if err != nil {
+				return nil, err
+			}
+			methods = append(methods, embedded...)
+			continue
+		}
+		ft, ok := field.Type.(*ast.FuncType)
+		if !ok {
+			continue
+		}
+		for _, name := range field.Names {
+			if !p.options.WithNotExported && !name.IsExported() {
+				continue
+			}
+			var docs []string
+			if p.options.CopyDocs {
+				docs = docLines(sf.text, field.Doc)
+			}
+			methods = append(methods, Method{
+				Name:       name.Name,
+				Code:       formatMethod(sf.text, name.Name, ft, p.options.PkgName, p.declaredTypes),
+				Docs:       docs,
+				Directives: methodDirectives(field.Doc),
+			})
+		}
+	}
+	return methods, nil
+}
+
+// interfaceEmbeds returns the methods of the interface embedded by field
+// of an interface declared in sf.
+func (p *promoter) interfaceEmbeds(sf *sourceFile, field *ast.Field) ([]Method, error) {
+	var methods []Method
+	for _, e := range sf.embeddedFields(&ast.FieldList{List: []*ast.Field{field}}) {
+		if e.pkgName == "" {
+			decl, ok := p.decls[e.typeName]
+			if !ok {
+				// Predeclared, e.g. any.
+				continue
+			}
+			if _, ok := decl.spec.Type.(*ast.InterfaceType); !ok {
+				continue
+			}
+			embedded, err := p.interfaceMethods(decl)
+			if err != nil {
+				return nil, err
+			}
+			methods = append(methods, embedded...)
+			continue
+		}
+		var sels []selector
+		if err := p.external(&embedding{embeddedType: e}, func(sel selector) { sels = append(sels, sel) }); err != nil {
+			return nil, err
+		}
+		for _, sel := range sels {
+			if sel.method != nil {
+				methods = append(methods, *sel.method)
+			}
+		}
+	}
+	return methods, nil
+}
+
+// lookup resolves the type of another package embedded by e, loading the
+// package in the directory of the file embedding it. A package that can't
+// be loaded, e.g. outside of a module or when it isn't downloaded, is
+// reported in p.warnings and no package is returned.
+func (p *promoter) lookup(e embeddedType) (*packages.Package, *types.TypeName, error) {
+	sf := e.file
+	importPath, unresolved := p.importPath(sf, e.pkgName)
+	if importPath == "" && len(unresolved) > 0 {
+		p.warnings = append(p.warnings, fmt.Sprintf("methods of embedded type %s are not promoted, its import isn't found: %s can't be loaded", e, strings.Join(unresolved, ", ")))
+		return nil, nil, nil
+	}
+	if importPath == "" {
+		return nil, nil, newParseError(sf.name, p.options.StructType, fmt.Errorf("can't find the import of embedded type %s", e))
+	}
+	pkg, err := p.c.loadPackage(filepath.Dir(sf.name), importPath, p.options.Build)
+	if err != nil {
+		p.warnings = append(p.warnings, fmt.Sprintf("methods of embedded type %s are not promoted, its package can't be loaded: %v", e, err))
+		return nil, nil, nil
+	}
+	obj, ok := pkg.Types.Scope().Lookup(e.typeName).(*types.TypeName)
+	if !ok {
+		return nil, nil, newParseError(sf.name, p.options.StructType, fmt.Errorf("embedded type %s not found in package %s", e, importPath))
+	}
+	return pkg, obj, nil
+}
+
+// importPath returns the import path of the package named name by the
+// imports of sf. An import without an alias whose path doesn't end with the
+// name of its package, e.g. github.com/jessevdk/go-flags of package flags,
+// is only found by loading the imported packages; unresolved lists those
+// that can't be loaded when name is not found.
+func (p *promoter) importPath(sf *sourceFile, name string) (importPath string, unresolved []string) {
+	specs := importSpecs(sf.file)
+	if importPath := importPathOf(specs, name); importPath != "" {
+		return importPath, nil
+	}
+	for _, spec := range specs {
+		alias, quoted := cutSpec(spec)
+		importPath, err := strconv.Unquote(quoted)
+		if err != nil || alias != "" || importPath == "C" {
+			continue
+		}
+		pkg, err := p.c.loadPackage(filepath.Dir(sf.name), importPath, p.options.Build)
+		if err != nil {
+			unresolved = append(unresolved, importPath)
+			continue
+		}
+		if pkg.Name == name {
+			return importPath, nil
+		}
+	}
+	return "", unresolved
+}
+
+// reserve records an import spec, e.g. `sq "database/sql"`, that is
+// already part of the generated file, so that other packages don't take
+// its name.
+func (it *importTracker) reserve(spec string) {
+	alias, quoted := cutSpec(spec)
+	importPath, err := strconv.Unquote(quoted)
+	if err != nil || alias == "." || alias == "_" {
+		return
+	}
+	explicit := alias != ""
+	if !explicit {
+		alias = importName(importPath)
+		it.unaliased[importPath] = true
+	}
+	if p, taken := it.used[alias]; taken && p != importPath {
+		return
+	}
+	it.used[alias] = importPath
+	if _, known := it.names[importPath]; explicit && !known {
+		it.names[importPath] = alias
+	}
+}
@@ -0,0 +1,111 @@
+package maker
+
+import (
+	"errors"
+	"fmt"
+	"go/scanner"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// ParseError describes a failure to parse or type check a source file.
+// It carries the location of the first problem, so that callers can
+// aggregate and report diagnostics.
+type ParseError struct {
+	// File is the name of the file that failed to parse.
+	File string
+	// Line and Column locate the first error in File, starting at 1.
+	// They are 0 when the position is unknown.
+	Line   int
+	Column int
+	// Struct is the name of the struct being processed, if any.
+	Struct string
+	// Err is the underlying error. For syntax errors it is a
+	// scanner.ErrorList holding every error found in File.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *ParseError) Error() string {
+	pos := e.File
+	if e.Line > 0 {
+		pos = fmt.Sprintf("%s:%d:%d", e.File, e.Line, e.Column)
+	}
+
+	msg := e.Err.Error()
+	var list scanner.ErrorList
+	if errors.As(e.Err, &list) && len(list) > 0 {
+		msg = list[0].Msg
+		if len(list) > 1 {
+			msg = fmt.Sprintf("%s (and %d more errors)", msg, len(list)-1)
+		}
+	}
+
+	if e.Struct != "" {
+		msg = fmt.Sprintf("%s (struct %s)", msg, e.Struct)
+	}
+	if pos == "" {
+		return msg
+	}
+	return fmt.Sprintf("%s: %s", pos, msg)
+}
+
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// newParseError wraps an error returned by parser.ParseFile for filename
+// into a *ParseError.
+func newParseError(filename, structName string, err error) error {
+	pe := &ParseError{File: filename, Struct: structName, Err: err}
+	var list scanner.ErrorList
+	if errors.As(err, &list) && len(list) > 0 {
+		pe.Line = list[0].Pos.Line
+		pe.Column = list[0].Pos.Column
+	}
+	return pe
+}
+
+// withStruct records structName as the struct being processed on err when
+// it is a *ParseError that doesn't name one yet.
+func withStruct(err error, structName string) error {
+	var pe *ParseError
+	if errors.As(err, &pe) && pe.Struct == "" {
+		pe.Struct = structName
+	}
+	return err
+}
+
+// packageError converts an error reported by go/packages into a *ParseError.
+// The position of such errors has the form "file:line:col", "file:line"
+// or is empty.
+func packageError(err packages.Error, structName string) error {
+	file := err.Pos
+	var nums []int
+	// File names may contain colons themselves, e.g. on Windows, so the
+	// numbers are taken from the end.
+	for len(nums) < 2 {
+		i := strings.LastIndex(file, ":")
+		if i < 0 {
+			break
+		}
+		n, convErr := strconv.Atoi(file[i+1:])
+		if convErr != nil {
+			break
+		}
+		nums = append([]int{n}, nums...)
+		file = file[:i]
+	}
+
+	pe := &ParseError{File: file, Struct: structName, Err: errors.New(err.Msg)}
+	if len(nums) > 0 {
+		pe.Line = nums[0]
+	}
+	if len(nums) > 1 {
+		pe.Column = nums[1]
+	}
+	return pe
+}
@@ -0,0 +1,112 @@
+package maker
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// namePattern matches method names. It's a regular expression when it's
+// enclosed in slashes, e.g. "/^(Get|List)/", and a glob otherwise,
+// e.g. "Get*".
+type namePattern struct {
+	text  string
+	match func(name string) bool
+	// used is set once the pattern matched a method.
+	used bool
+}
+
+// parseNamePattern parses a glob or regular expression pattern.
+func parseNamePattern(text string) (*namePattern, error) {
+	if len(text) > 1 && strings.HasPrefix(text, "/") && strings.HasSuffix(text, "/") {
+		re, err := regexp.Compile(text[1 : len(text)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", text, err)
+		}
+		return &namePattern{text: text, match: re.MatchString}, nil
+	}
+	if _, err := path.Match(text, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", text, err)
+	}
+	return &namePattern{text: text, match: func(name string) bool {
+		ok, _ := path.Match(text, name)
+		return ok
+	}}, nil
+}
+
+// parseNamePatterns parses all of texts, see parseNamePattern.
+func parseNamePatterns(texts []string) ([]*namePattern, error) {
+	patterns := make([]*namePattern, len(texts))
+	for i, text := range texts {
+		p, err := parseNamePattern(text)
+		if err != nil {
+			return nil, err
+		}
+		patterns[i] = p
+	}
+	return patterns, nil
+}
+
+// parseFoldedNamePatterns parses texts like parseNamePatterns into
+// patterns matching lower case names regardless of the case of the
+// patterns.
+func parseFoldedNamePatterns(texts []string) ([]*namePattern, error) {
+	folded := make([]string, len(texts))
+	for i, text := range texts {
+		if len(text) > 1 && strings.HasPrefix(text, "/") && strings.HasSuffix(text, "/") {
+			folded[i] = "/(?i)" + text[1:]
+		} else {
+			folded[i] = strings.ToLower(text)
+		}
+	}
+	return parseNamePatterns(folded)
+}
+
+// matchAny reports whether name matches one of patterns, marking all the
+// patterns it matches as used.
+func matchAny(patterns []*namePattern, name string) bool {
+	matched := false
+	for _, p := range patterns {
+		if p.match(name) {
+			p.used = true
+			matched = true
+		}
+	}
+	return matched
+}
+
+// filterNames keeps the methods of data matching one of the patterns of
+// options.Include, if any, and not matching any of options.Exclude. A
+// warning is added for every pattern that doesn't match any method.
+func filterNames(data *Interface, options MakeOptions) error {
+	include, err := parseNamePatterns(options.Include)
+	if err != nil {
+		return err
+	}
+	exclude, err := parseNamePatterns(options.Exclude)
+	if err != nil {
+		return err
+	}
+
+	var methods []Method
+	for _, m := range data.Methods {
+		included := matchAny(include, m.Name) || len(include) == 0
+		if excluded := matchAny(exclude, m.Name); included && !excluded {
+			methods = append(methods, m)
+		}
+	}
+	data.Methods = methods
+
+	for _, p := range include {
+		if !p.used {
+			data.Warnings = append(data.Warnings, fmt.Sprintf("include pattern %q matches no method of %s", p.text, data.StructName))
+		}
+	}
+	for _, p := range exclude {
+		if !p.used {
+			data.Warnings = append(data.Warnings, fmt.Sprintf("exclude pattern %q matches no method of %s", p.text, data.StructName))
+		}
+	}
+	return nil
+}
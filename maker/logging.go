@@ -0,0 +1,142 @@
+package maker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultRedact are the patterns of the names of the parameters whose value
+// isn't logged by the logging decorators when MakeOptions.Redact is empty.
+var DefaultRedact = []string{"*password*", "*passwd*", "*secret*", "*token*", "*credential*", "*apikey*", "*api_key*"}
+
+// redactedValue replaces the values of redacted parameters in the logs.
+const redactedValue = "[REDACTED]"
+
+// MakeLogging generates a decorator of the interface described by options
+// logging every call with log/slog. The decorator is named after the
+// interface, e.g. LoggingStore, belongs to the same package and is meant to
+// be written to a separate file next to it.
+func MakeLogging(options MakeOptions) ([]byte, error) {
+	return NewGenerator().MakeLogging(options)
+}
+
+// MakeLogging generates a logging decorator of the interface described by
+// options, see MakeLogging.
+func (g *Generator) MakeLogging(options MakeOptions) ([]byte, error) {
+	data, err := g.cache.collectImplemented(options)
+	if err != nil {
+		return nil, err
+	}
+	return RenderLogging(data, options)
+}
+
+// RenderLogging renders the logging decorator of iface, redacting the
+// parameters matching options.Redact, see MakeLogging.
+func RenderLogging(iface *Interface, options MakeOptions) ([]byte, error) {
+	if err := checkImplemented(iface, "logging decorator"); err != nil {
+		return nil, err
+	}
+	redact := options.Redact
+	switch {
+	case options.NoRedact:
+		redact = nil
+	case len(redact) == 0:
+		redact = DefaultRedact
+	}
+	return MakeLoggingCode(iface, redact)
+}
+
+// MakeLoggingCode generates the struct LoggingIfaceName implementing iface
+// by calling the same methods of its field Next and logging the calls with
+// its Logger: the call with its arguments and its return at debug level,
+// or the error returned as the last result at error level. The values of
+// the parameters whose name matches one of the patterns of redact, ignoring
+// case, are replaced with "[REDACTED]". Methods with a nolog directive
+// are not logged. A leading context.Context parameter is passed on to the
+// logger.
+func MakeLoggingCode(iface *Interface, redact []string) ([]byte, error) {
+	targs, err := typeParamNames(iface.TypeParams)
+	if err != nil {
+		return nil, err
+	}
+	redacted, err := parseFoldedNamePatterns(redact)
+	if err != nil {
+		return nil, err
+	}
+	logging := "Logging" + iface.IfaceName
+	next, logger := memberName(iface, "Next"), memberName(iface, "Logger")
+
+	imports := &decoratorImports{iface: iface}
+	contextPkg := imports.use("context")
+	slogPkg := imports.use("log/slog")
+
+	var b strings.Builder
+	writeHeader(&b, iface, imports.specs)
+	fmt.Fprintf(&b, "// %s implements %s by logging every call to %s with %s.\n", logging, iface.IfaceName, next, logger)
+	fmt.Fprintf(&b, "type %s%s struct {\n%s %s%s\n%s *%s.Logger\n}\n", logging, iface.TypeParams, next, iface.IfaceName, targs, logger, slogPkg)
+	writeImplements(&b, iface, logging+targs+"{}")
+	fmt.Fprintf(&b, "\n// New%s returns a %s logging the calls to next with logger.\n", logging, logging)
+	fmt.Fprintf(&b, "func New%s%s(next %s%s, logger *%s.Logger) %s%s {\n", logging, iface.TypeParams, iface.IfaceName, targs, slogPkg, logging, targs)
+	fmt.Fprintf(&b, "return %s%s{%s: next, %s: logger}\n}\n", logging, targs, next, logger)
+
+	for _, m := range iface.Methods {
+		d := newDecoratedMethod(m, imports.names)
+		recv := d.declare("l")
+		call := d.call(recv + "." + next)
+		if _, ok := m.Directive("nolog"); ok {
+			fmt.Fprintf(&b, "\n// %s calls %s.%s.\n", m.Name, next, m.Name)
+			b.WriteString(d.signature(recv, logging+targs))
+			if len(m.Results) > 0 {
+				call = "return " + call
+			}
+			b.WriteString(call + "\n}\n")
+			continue
+		}
+
+		fmt.Fprintf(&b, "\n// %s calls %s.%s and logs it.\n", m.Name, next, m.Name)
+		b.WriteString(d.signature(recv, logging+targs))
+		ctx := d.context()
+		params := d.params
+		if ctx != "" {
+			params = params[1:]
+		} else {
+			ctx = contextPkg + ".Background()"
+		}
+		var attrs []string
+		for _, p := range params {
+			if matchAny(redacted, strings.ToLower(p.Name)) {
+				attrs = append(attrs, fmt.Sprintf("%s.String(%s, %s)", slogPkg, strconv.Quote(p.Name), strconv.Quote(redactedValue)))
+			} else {
+				attrs = append(attrs, fmt.Sprintf("%s.Any(%s, %s)", slogPkg, strconv.Quote(p.Name), p.Name))
+			}
+		}
+		name := iface.IfaceName + "." + m.Name
+		logf := func(level, msg string, attrs ...string) {
+			args := append([]string{ctx, slogPkg + "." + level, strconv.Quote(msg)}, attrs...)
+			fmt.Fprintf(&b, "%s.%s.LogAttrs(%s)\n", recv, logger, strings.Join(args, ", "))
+		}
+		logf("LevelDebug", "calling "+name, attrs...)
+
+		vars := d.resultVars()
+		if len(vars) > 0 {
+			call = strings.Join(vars, ", ") + " := " + call
+		}
+		b.WriteString(call + "\n")
+		if d.returnsError() {
+			errVar := vars[len(vars)-1]
+			fmt.Fprintf(&b, "if %s != nil {\n", errVar)
+			logf("LevelError", name+" failed", fmt.Sprintf("%s.Any(\"error\", %s)", slogPkg, errVar))
+			b.WriteString("} else {\n")
+			logf("LevelDebug", name+" returned")
+			b.WriteString("}\n")
+		} else {
+			logf("LevelDebug", name+" returned")
+		}
+		if len(vars) > 0 {
+			fmt.Fprintf(&b, "return %s\n", strings.Join(vars, ", "))
+		}
+		b.WriteString("}\n")
+	}
+	return FormatCode(b.String())
+}
@@ -4,13 +4,13 @@ import (
 	"fmt"
 	"go/ast"
 	"go/doc"
-	"go/parser"
 	"go/token"
 	"log"
-	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 
 	"golang.org/x/tools/imports"
 )
@@ -21,6 +21,35 @@ type Method struct {
 	Name string
 	Code string
 	Docs []string
+	// PointerReceiver is set when the method is only
+	// in the method set of a pointer to the struct.
+	PointerReceiver bool
+	// Params and Results describe the signature in Code
+	// with one entry per value.
+	Params  []Param
+	Results []Param
+	// Directives are the //ifacemaker: directives of the method's
+	// doc comment without the prefix, e.g. "only=Reader", see Directive.
+	Directives []string
+	// Original is the name of the method of the struct when a rename
+	// directive gives it another Name in the interface.
+	Original string
+}
+
+// Param is a single parameter or result of a method.
+type Param struct {
+	// Name is empty for unnamed values.
+	Name string
+	// Type is the type expression as it appears in Code,
+	// without the "..." of a variadic parameter.
+	Type string
+	// PkgPath is the import path of the package declaring
+	// the named type Type refers to, looking through
+	// pointers, slices, arrays and channels. It's empty
+	// for predeclared types, type parameters and other
+	// types, e.g. maps and funcs.
+	PkgPath  string
+	Variadic bool
 }
 
 // declaredType identifies the name and package of a type declaration.
@@ -93,6 +122,12 @@ func getTypeDeclarationNames(decl ast.Decl) []string {
 // Behavior is undefined for a src []byte that
 // isn't the source of the possible FuncDecl fl
 func GetReceiverTypeName(src []byte, fl ast.Decl) (string, *ast.FuncDecl) {
+	return getReceiverTypeName(srcText(src, 1), fl)
+}
+
+// getReceiverTypeName implements GetReceiverTypeName
+// reading source code with text.
+func getReceiverTypeName(text nodeText, fl ast.Decl) (string, *ast.FuncDecl) {
 	fd, ok := fl.(*ast.FuncDecl)
 	if !ok {
 		return "", nil
@@ -101,17 +136,21 @@ func GetReceiverTypeName(src []byte, fl ast.Decl) (string, *ast.FuncDecl) {
 	if err != nil {
 		return "", nil
 	}
-	st := string(src[t.Pos()-1 : t.End()-1])
+	st := text(t)
 	if len(st) > 0 && st[0] == '*' {
 		st = st[1:]
 	}
 	// Strip generic type parameters if present, e.g. Foo[T] -> Foo
-	if m := regexp.MustCompile(`^(\w+)(?:\[.+\])?$`).FindStringSubmatch(st); m != nil {
+	if m := reMatchReceiverName.FindStringSubmatch(st); m != nil {
 		st = m[1]
 	}
 	return st, fd
 }
 
+// reMatchReceiverName matches a receiver type name
+// with optional type parameters, e.g. Foo[T].
+var reMatchReceiverName = regexp.MustCompile(`^(\w+)(?:\[.+\])?$`)
+
 // GetReceiverType checks if the FuncDecl
 // is a function or a method. If it is a
 // function it returns a nil ast.Expr and
@@ -129,14 +168,31 @@ func GetReceiverType(fd *ast.FuncDecl) (ast.Expr, error) {
 	return fd.Recv.List[0].Type, nil
 }
 
-// getEmbeddedStructName returns the base struct name for an embedded field.
-// It unwraps pointers and generic instantiations to get the underlying type
-// identifier so embedded methods can be associated correctly.
+// isPointerReceiver reports whether the method
+// declared by fd has a pointer receiver.
+func isPointerReceiver(fd *ast.FuncDecl) bool {
+	t, err := GetReceiverType(fd)
+	if err != nil {
+		return false
+	}
+	_, ok := t.(*ast.StarExpr)
+	return ok
+}
+
+// getEmbeddedStructName returns the base struct name for an embedded field,
+// "pkg.Name" for types of other packages. It unwraps pointers and generic
+// instantiations to get the underlying type identifier so embedded methods
+// can be associated correctly.
 func getEmbeddedStructName(expr ast.Expr) string {
 	switch e := expr.(type) {
 	case *ast.Ident:
 		return e.Name
 	case *ast.SelectorExpr:
+		// Types of other packages keep their qualifier so
+		// that they aren't confused with local types.
+		if x, ok := e.X.(*ast.Ident); ok {
+			return x.Name + "." + e.Sel.Name
+		}
 		return e.Sel.Name
 	case *ast.StarExpr:
 		return getEmbeddedStructName(e.X)
@@ -201,6 +257,12 @@ func baseIdentName(expr ast.Expr) string {
 // where each element is one parameter or return value formatted as it appears
 // in the source. If the FieldList input is nil, it returns nil.
 func FormatFieldList(src []byte, fl *ast.FieldList, pkgName string, declaredTypes []declaredType) []string {
+	return formatFieldList(srcText(src, 1), fl, pkgName, declaredTypes)
+}
+
+// formatFieldList implements FormatFieldList
+// reading source code with text.
+func formatFieldList(text nodeText, fl *ast.FieldList, pkgName string, declaredTypes []declaredType) []string {
 	if fl == nil {
 		return nil
 	}
@@ -210,7 +272,7 @@ func FormatFieldList(src []byte, fl *ast.FieldList, pkgName string, declaredType
 		for i, n := range l.Names {
 			names[i] = n.Name
 		}
-		t := string(src[l.Type.Pos()-1 : l.Type.End()-1])
+		t := text(l.Type)
 		// Try to match <modifier><type>. If matched variable `match` will look like this for t=="[]Category":
 		// match[0][0] = "[]Category"
 		// match[0][1] = "[]"
@@ -238,8 +300,7 @@ func FormatFieldList(src []byte, fl *ast.FieldList, pkgName string, declaredType
 		// Strip destination package prefix when source code imports the
 		// same package we are generating into. This handles pointers,
 		// arrays, maps and other composite types.
-		regexString := fmt.Sprintf(`(^|[^\w])%s\.`, regexp.QuoteMeta(pkgName))
-		t = regexp.MustCompile(regexString).ReplaceAllString(t, "$1")
+		t = pkgPrefixRegexp(pkgName).ReplaceAllString(t, "$1")
 
 		if len(names) > 0 {
 			typeSharingArgs := strings.Join(names, ", ")
@@ -251,6 +312,20 @@ func FormatFieldList(src []byte, fl *ast.FieldList, pkgName string, declaredType
 	return parts
 }
 
+// pkgPrefixRegexps caches the regexps returned by pkgPrefixRegexp.
+var pkgPrefixRegexps sync.Map
+
+// pkgPrefixRegexp returns a regexp matching the
+// qualifier "pkgName." in a type expression.
+func pkgPrefixRegexp(pkgName string) *regexp.Regexp {
+	if re, ok := pkgPrefixRegexps.Load(pkgName); ok {
+		return re.(*regexp.Regexp)
+	}
+	re := regexp.MustCompile(fmt.Sprintf(`(^|[^\w])%s\.`, regexp.QuoteMeta(pkgName)))
+	pkgPrefixRegexps.Store(pkgName, re)
+	return re
+}
+
 // FormatCode sets the options of the imports
 // pkg and then applies the Process method
 // which by default removes all of the imports
@@ -278,45 +353,37 @@ func FormatCode(code string) ([]byte, error) {
 var reMatchDirective = regexp.MustCompile(`^(//go|go):\S+`)
 
 // MakeInterface takes in all of the items
-// required for generating the interface,
-// it then simply concatenates them all
-// to an array, joins this array to a string
-// with newline and passes it on to FormatCode
-// which then directly returns the result
+// required for generating the interface
+// and renders them with DefaultTemplate.
+// Each of the methods lines, code or doc,
+// is written to the interface as is.
 func MakeInterface(comment, pkgName, ifaceName, ifaceComment, typeParams string, methods []string, imports []string) ([]byte, error) {
-	output := []string{
-		"// " + comment,
-		"",
-		"package " + pkgName,
-		"import (",
-	}
-	output = append(output, imports...)
-	output = append(output,
-		")",
-		"",
-	)
-	if len(ifaceComment) > 0 {
-		prefix := "// "
-		if reMatchDirective.MatchString(ifaceComment) {
-			prefix = "//"
-		}
-		output = append(output, fmt.Sprintf("%s%s", prefix, strings.ReplaceAll(ifaceComment, "\n", "\n// ")))
-	}
-	output = append(output, fmt.Sprintf("type %s%s interface {", ifaceName, typeParams))
-	output = append(output, methods...)
-	output = append(output, "}")
-	code := strings.Join(output, "\n")
-	return FormatCode(code)
+	data := &TemplateData{Interface: Interface{
+		Comment:      comment,
+		PkgName:      pkgName,
+		Imports:      imports,
+		IfaceName:    ifaceName,
+		IfaceComment: ifaceComment,
+		TypeParams:   typeParams,
+	}}
+	for _, line := range methods {
+		data.Methods = append(data.Methods, Method{Code: line})
+	}
+	return RenderTemplate(defaultTemplate, data)
 }
 
-// ParseDeclaredTypes inspect given src code to find type declaractions.
-func ParseDeclaredTypes(src []byte) (declaredTypes []declaredType) {
-	fset := token.NewFileSet()
-	a, err := parser.ParseFile(fset, "src.go", src, parser.ParseComments)
+// ParseDeclaredTypes inspect given src code of the file filename to find
+// type declaractions. A *ParseError is returned if src can't be parsed.
+func ParseDeclaredTypes(filename string, src []byte) (declaredTypes []declaredType, err error) {
+	sf, err := parseSourceFile(token.NewFileSet(), filename, src)
 	if err != nil {
-		log.Fatal(err.Error())
+		return nil, err
 	}
+	return sf.declaredTypes, nil
+}
 
+// declaredTypesOf returns the type declarations of the file a.
+func declaredTypesOf(a *ast.File) (declaredTypes []declaredType) {
 	sourcePackageName := a.Name.Name
 
 	for _, d := range a.Decls {
@@ -331,15 +398,20 @@ func ParseDeclaredTypes(src []byte) (declaredTypes []declaredType) {
 	return
 }
 
-// ParseEmbeddingGraph inspects the given source code to find
-// the embedding relationship between structs
-func ParseEmbeddingGraph(src []byte) map[string][]string {
-	fileSet := token.NewFileSet()
-	file, err := parser.ParseFile(fileSet, "src.go", src, parser.ParseComments)
+// ParseEmbeddingGraph inspects the given source code of the file filename
+// to find the embedding relationship between structs. A *ParseError is
+// returned if src can't be parsed.
+func ParseEmbeddingGraph(filename string, src []byte) (map[string][]string, error) {
+	sf, err := parseSourceFile(token.NewFileSet(), filename, src)
 	if err != nil {
-		log.Fatal(err.Error())
+		return nil, err
 	}
+	return sf.embeddingGraph, nil
+}
 
+// embeddingGraphOf returns the embedding relationship
+// between the structs declared in file.
+func embeddingGraphOf(file *ast.File) map[string][]string {
 	// Track the embedding graph
 	embeddingGraph := make(map[string][]string)
 	for _, decl := range file.Decls {
@@ -384,8 +456,8 @@ func ParseEmbeddingGraph(src []byte) map[string][]string {
 	return embeddingGraph
 }
 
-// ParseStruct takes in a piece of source code as a
-// []byte, the name of the struct it should base the
+// ParseStruct takes in a piece of source code of the
+// file filename as a []byte, the name of the struct it should base the
 // interface on and a bool saying whether it should
 // include docs.  It then returns an []Method where
 // Method contains the method declaration(not the code)
@@ -394,14 +466,60 @@ func ParseEmbeddingGraph(src []byte) map[string][]string {
 // It also returns a []string containing all of the imports
 // including their aliases regardless of them being used or
 // not, the imports not used will be removed later using the
-// 'imports' pkg If anything goes wrong, this method will
-// fatally stop the execution
-func ParseStruct(src []byte, structName string, copyDocs bool, copyTypeDocs bool, pkgName string, declaredTypes []declaredType, importModule string, withNotExported bool, embeddedStructNamesSet map[string]struct{}, withPromoted bool) (methods []Method, imports []string, typeDoc string, typeParams string) {
-	fset := token.NewFileSet()
-	a, err := parser.ParseFile(fset, "src.go", src, parser.ParseComments)
+// 'imports' pkg. If src can't be parsed, a *ParseError
+// is returned.
+func ParseStruct(filename string, src []byte, structName string, copyDocs bool, copyTypeDocs bool, pkgName string, declaredTypes []declaredType, importModule string, withNotExported bool, embeddedStructNamesSet map[string]struct{}, withPromoted bool) (methods []Method, imports []string, typeDoc string, typeParams string, err error) {
+	sf, err := parseSourceFile(token.NewFileSet(), filename, src)
 	if err != nil {
-		log.Fatal(err.Error())
+		return nil, nil, "", "", withStruct(err, structName)
 	}
+	methods, imports, typeDoc, typeParams = parseStruct(sf, structName, copyDocs, copyTypeDocs, pkgName, declaredTypes, importModule, withNotExported, embeddedStructNamesSet, withPromoted)
+	return
+}
+
+// importSpecs returns the imports of the file a, including their aliases.
+func importSpecs(a *ast.File) []string {
+	var imports []string
+	for _, i := range a.Imports {
+		if i.Name != nil {
+			imports = append(imports, fmt.Sprintf("%s %s", i.Name.String(), i.Path.Value))
+		} else {
+			imports = append(imports, i.Path.Value)
+		}
+	}
+	return imports
+}
+
+// formatMethod formats the method name of type ft as it appears in an
+// interface, e.g. "Get(id string) (int, error)".
+func formatMethod(text nodeText, name string, ft *ast.FuncType, pkgName string, declaredTypes []declaredType) string {
+	params := formatFieldList(text, ft.Params, pkgName, declaredTypes)
+	ret := formatFieldList(text, ft.Results, pkgName, declaredTypes)
+	if len(ret) == 0 {
+		return fmt.Sprintf("%s(%s)", name, strings.Join(params, ", "))
+	}
+	return fmt.Sprintf("%s(%s) (%s)", name, strings.Join(params, ", "), strings.Join(ret, ", "))
+}
+
+// docLines returns the lines of the doc comment cg, without go and
+// ifacemaker directives.
+func docLines(text nodeText, cg *ast.CommentGroup) []string {
+	if cg == nil {
+		return nil
+	}
+	var docs []string
+	for _, d := range cg.List {
+		commentLine := text(d)
+		if !isDirective(commentLine) {
+			docs = append(docs, commentLine)
+		}
+	}
+	return docs
+}
+
+// parseStruct implements ParseStruct on an already parsed source file.
+func parseStruct(sf *sourceFile, structName string, copyDocs bool, copyTypeDocs bool, pkgName string, declaredTypes []declaredType, importModule string, withNotExported bool, embeddedStructNamesSet map[string]struct{}, withPromoted bool) (methods []Method, imports []string, typeDoc string, typeParams string) {
+	a, text := sf.file, sf.text
 
 	// Extract type parameters for the struct if present.
 	for _, decl := range a.Decls {
@@ -415,21 +533,12 @@ func ParseStruct(src []byte, structName string, copyDocs bool, copyTypeDocs bool
 				continue
 			}
 			if ts.TypeParams != nil {
-				// Subtracting 1 from ts.TypeParams.Pos() and ts.TypeParams.End() adjusts the indices
-				// to match the zero-based indexing of the src slice. This ensures the correct
-				// extraction of type parameters from the source code.
-				typeParams = string(src[ts.TypeParams.Pos()-1 : ts.TypeParams.End()-1])
+				typeParams = text(ts.TypeParams)
 			}
 		}
 	}
 
-	for _, i := range a.Imports {
-		if i.Name != nil {
-			imports = append(imports, fmt.Sprintf("%s %s", i.Name.String(), i.Path.Value))
-		} else {
-			imports = append(imports, i.Path.Value)
-		}
-	}
+	imports = importSpecs(a)
 
 	if importModule != "" {
 		imports = append(imports, fmt.Sprintf(". %s", strconv.Quote(importModule)))
@@ -441,7 +550,7 @@ func ParseStruct(src []byte, structName string, copyDocs bool, copyTypeDocs bool
 
 	// Process direct methods first
 	for _, d := range a.Decls {
-		if a, fd := GetReceiverTypeName(src, d); a == structName {
+		if a, fd := getReceiverTypeName(text, d); a == structName {
 			mName := fd.Name.String()
 			if _, ok := methodSet[mName]; ok {
 				continue
@@ -449,30 +558,16 @@ func ParseStruct(src []byte, structName string, copyDocs bool, copyTypeDocs bool
 			if !withNotExported && !fd.Name.IsExported() {
 				continue
 			}
-			params := FormatFieldList(src, fd.Type.Params, pkgName, declaredTypes)
-			ret := FormatFieldList(src, fd.Type.Results, pkgName, declaredTypes)
-
-			mName = fd.Name.String()
-			method := ""
-			if len(ret) == 0 {
-				method = fmt.Sprintf("%s(%s)", mName, strings.Join(params, ", "))
-			} else {
-				method = fmt.Sprintf("%s(%s) (%s)", mName, strings.Join(params, ", "), strings.Join(ret, ", "))
-			}
-
 			var docs []string
-			if fd.Doc != nil && copyDocs {
-				for _, d := range fd.Doc.List {
-					commentLine := string(src[d.Pos()-1 : d.End()-1])
-					if !reMatchDirective.MatchString(commentLine) {
-						docs = append(docs, commentLine)
-					}
-				}
+			if copyDocs {
+				docs = docLines(text, fd.Doc)
 			}
 			methods = append(methods, Method{
-				Name: mName,
-				Code: method,
-				Docs: docs,
+				Name:            mName,
+				Code:            formatMethod(text, mName, fd.Type, pkgName, declaredTypes),
+				Docs:            docs,
+				PointerReceiver: isPointerReceiver(fd),
+				Directives:      methodDirectives(fd.Doc),
 			})
 			methodSet[mName] = struct{}{}
 		}
@@ -481,7 +576,7 @@ func ParseStruct(src []byte, structName string, copyDocs bool, copyTypeDocs bool
 	// Add promoted methods next
 	if withPromoted {
 		for _, d := range a.Decls {
-			a, fd := GetReceiverTypeName(src, d)
+			a, fd := getReceiverTypeName(text, d)
 			_, isEmbedded := embeddedStructNamesSet[a]
 			if isEmbedded {
 				mName := fd.Name.String()
@@ -491,27 +586,16 @@ func ParseStruct(src []byte, structName string, copyDocs bool, copyTypeDocs bool
 				if !withNotExported && !fd.Name.IsExported() {
 					continue
 				}
-				params := FormatFieldList(src, fd.Type.Params, pkgName, declaredTypes)
-				ret := FormatFieldList(src, fd.Type.Results, pkgName, declaredTypes)
-				method := ""
-				if len(ret) == 0 {
-					method = fmt.Sprintf("%s(%s)", mName, strings.Join(params, ", "))
-				} else {
-					method = fmt.Sprintf("%s(%s) (%s)", mName, strings.Join(params, ", "), strings.Join(ret, ", "))
-				}
 				var docs []string
-				if fd.Doc != nil && copyDocs {
-					for _, d := range fd.Doc.List {
-						commentLine := string(src[d.Pos()-1 : d.End()-1])
-						if !reMatchDirective.MatchString(commentLine) {
-							docs = append(docs, commentLine)
-						}
-					}
+				if copyDocs {
+					docs = docLines(text, fd.Doc)
 				}
 				methods = append(methods, Method{
-					Name: mName,
-					Code: method,
-					Docs: docs,
+					Name:            mName,
+					Code:            formatMethod(text, mName, fd.Type, pkgName, declaredTypes),
+					Docs:            docs,
+					PointerReceiver: isPointerReceiver(fd),
+					Directives:      methodDirectives(fd.Doc),
 				})
 				methodSet[mName] = struct{}{}
 			}
@@ -519,7 +603,8 @@ func ParseStruct(src []byte, structName string, copyDocs bool, copyTypeDocs bool
 	}
 
 	if copyTypeDocs {
-		pkgDoc, err := doc.NewFromFiles(fset, []*ast.File{a}, "", doc.AllDecls)
+		// The AST is shared with other passes and must not be modified.
+		pkgDoc, err := doc.NewFromFiles(sf.fset, []*ast.File{a}, "", doc.AllDecls|doc.PreserveAST)
 		if err == nil {
 			for _, t := range pkgDoc.Types {
 				if t.Name == structName {
@@ -534,7 +619,27 @@ func ParseStruct(src []byte, structName string, copyDocs bool, copyTypeDocs bool
 
 // MakeOptions contains options for the Make function.
 type MakeOptions struct {
-	Files           []string
+	Files []string
+	// SourceDir is a directory or the import path of a package whose Go
+	// files are read in addition to Files. The files are selected like the
+	// go command does according to Build, resolved in Dir.
+	SourceDir string
+	// Package is a package import pattern, e.g. "./internal/store". When set,
+	// the package is loaded with go/packages and method signatures are
+	// rendered from type information instead of parsing Files.
+	Package string
+	// Type is a fully qualified type reference "importpath.TypeName", e.g.
+	// "database/sql.DB". The package is resolved through the module cache or
+	// GOROOT, and the full method set of the type, including promoted
+	// methods, is used. It overrides Package and StructType.
+	Type string
+	// Dir is the directory SourceDir, Package or Type are resolved in.
+	// The current working directory is used when empty.
+	Dir string
+	// Build selects the files of SourceDir and Package. When it sets
+	// Tags, GOOS or GOARCH, Files are filtered by their build
+	// constraints as well.
+	Build           BuildConfig
 	StructType      string
 	Comment         string
 	PkgName         string
@@ -546,6 +651,51 @@ type MakeOptions struct {
 	CopyTypeDoc     bool
 	ExcludeMethods  []string
 	WithNotExported bool
+	// Include and Exclude are glob patterns, e.g. "Get*", or regular
+	// expressions enclosed in slashes, e.g. "/^(Get|List)/", selecting
+	// methods by name. When Include is set, only the methods matching one
+	// of its patterns are kept, and the ones matching one of Exclude are
+	// left out.
+	Include []string
+	Exclude []string
+	// Roles split the methods into several interfaces declared in the
+	// same file. IfaceName, when set, then names a composite interface
+	// embedding all of them.
+	Roles []RoleOptions
+	// Assert appends a compile-time assertion that the struct implements
+	// the interface to the generated file.
+	Assert bool
+	// Template is the path of a text/template file used to render the
+	// interface instead of DefaultTemplate, see TemplateData.
+	Template string
+	// Workers is the maximum number of files read and parsed
+	// concurrently, runtime.GOMAXPROCS(0) if it is not positive.
+	Workers int
+	// ValueReceiver makes the interface match the method set of the struct
+	// value T rather than the one of *T: methods with a pointer receiver
+	// are left out, unless they're promoted through an embedded pointer.
+	ValueReceiver bool
+	// EmbedInterfaces, with WithPromoted, embeds the interfaces embedded
+	// in the struct, or in the structs it embeds, into the generated
+	// interface instead of listing their methods.
+	EmbedInterfaces bool
+	// UsedBy is a package pattern of a consumer of the struct, resolved in
+	// Dir. When set, the interface only has the methods that the consumer
+	// calls on its fields and parameters of the struct type.
+	UsedBy string
+	// Metrics names the metrics recorded by the decorators generated by
+	// MakeMetrics.
+	Metrics MetricsOptions
+	// Redact are the patterns, like Include, of the names of the
+	// parameters whose value isn't logged by the decorators generated by
+	// MakeLogging, ignoring case. DefaultRedact is used when it is empty.
+	Redact []string
+	// NoRedact turns redaction off, every parameter is logged.
+	NoRedact bool
+	// PkgPath is the import path of the package PkgName the interface is
+	// generated into, if it's known. The types of that package are left
+	// unqualified, while other packages with the same name are imported.
+	PkgPath string
 }
 
 // validateStructType checks input struct type against the parsed declared
@@ -561,9 +711,135 @@ func validateStructType(types []declaredType, stType string) bool {
 
 }
 
+// Make generates the interface described by options and returns the
+// formatted source code of the generated file.
 func Make(options MakeOptions) ([]byte, error) {
+	return NewGenerator().Make(options)
+}
+
+// Generator generates interfaces and the files built on top of them.
+// Source files and packages are read and parsed only once per Generator,
+// so a single Generator should be used for all targets of one run. It is
+// safe for concurrent use.
+type Generator struct {
+	cache *sourceCache
+}
+
+// NewGenerator returns a Generator with nothing loaded yet.
+func NewGenerator() *Generator {
+	return &Generator{cache: newSourceCache()}
+}
+
+// Make generates the interface described by options, see Make.
+func (g *Generator) Make(options MakeOptions) ([]byte, error) {
+	return g.cache.make(options)
+}
+
+// MakeAll generates the interfaces for all given options in one run and
+// returns the generated files in the same order. Source files and packages
+// shared between several targets are read and parsed only once.
+func MakeAll(options []MakeOptions) ([][]byte, error) {
+	g := NewGenerator()
+	results := make([][]byte, len(options))
+	for i, o := range options {
+		result, err := g.Make(o)
+		if err != nil {
+			return nil, fmt.Errorf("interface %s: %w", o.IfaceName, err)
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
+func isStructType(embeddingGraph map[string][]string, name string) bool {
+	_, ok := embeddingGraph[name]
+	return ok
+}
+
+// excludedSet returns the set of method names excluded by options.
+func excludedSet(options MakeOptions) map[string]struct{} {
+	excludedMethods := make(map[string]struct{}, len(options.ExcludeMethods))
+	for _, mName := range options.ExcludeMethods {
+		excludedMethods[mName] = struct{}{}
+	}
+	return excludedMethods
+}
+
+func (c *sourceCache) make(options MakeOptions) ([]byte, error) {
+	iface, err := c.collect(options)
+	if err != nil {
+		return nil, err
+	}
+	return Render(iface, options)
+}
+
+// collect gathers the methods, imports and docs of the interface described
+// by options.
+func (c *sourceCache) collect(options MakeOptions) (*Interface, error) {
+	var (
+		data *Interface
+		err  error
+	)
+	if options.Package != "" || options.Type != "" {
+		data, err = c.collectFromPackage(options)
+	} else {
+		data, err = c.collectFromFiles(options)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := applyDirectives(data, options); err != nil {
+		return nil, withStruct(err, options.StructType)
+	}
+	if len(options.Include) > 0 || len(options.Exclude) > 0 {
+		if err := filterNames(data, options); err != nil {
+			return nil, err
+		}
+	}
+	if options.ValueReceiver {
+		methods := data.Methods[:0:0]
+		for _, m := range data.Methods {
+			if !m.PointerReceiver {
+				methods = append(methods, m)
+			}
+		}
+		data.Methods = methods
+	}
+	if options.UsedBy != "" {
+		if err := c.filterUsed(data, options); err != nil {
+			return nil, err
+		}
+	}
+	if len(options.Roles) > 0 {
+		if err := splitRoles(data, options.Roles); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// collectFromFiles implements collect for MakeOptions.Files.
+func (c *sourceCache) collectFromFiles(options MakeOptions) (*Interface, error) {
+	if options.Build.constrained() {
+		// Files are only filtered when asked to, to keep merging all of
+		// them by default.
+		files, err := MatchFiles(options.Files, options.Build)
+		if err != nil {
+			return nil, err
+		}
+		options.Files = files
+	}
+	if options.SourceDir != "" {
+		files, err := PackageFiles(options.Dir, options.SourceDir, options.Build)
+		if err != nil {
+			return nil, err
+		}
+		options.Files = append(options.Files[:len(options.Files):len(options.Files)], files...)
+	}
+
 	var (
-		allMethods       []string
+		allMethods       []Method
+		allEmbeds        []string
 		allImports       []string
 		allDeclaredTypes []declaredType
 
@@ -576,19 +852,27 @@ func Make(options MakeOptions) ([]byte, error) {
 	var (
 		typeDoc     string
 		ifaceParams string
+		structPkg   string
+		structDir   string
 	)
 
+	files, err := c.loadFiles(options.Files, options.Workers)
+	if err != nil {
+		return nil, withStruct(err, options.StructType)
+	}
+
 	// First pass on all files to find declared types
-	for _, f := range options.Files {
-		b, err := os.ReadFile(f)
-		if err != nil {
-			return []byte{}, err
-		}
-		types := ParseDeclaredTypes(b)
-		graph := ParseEmbeddingGraph(b)
+	for fi, f := range options.Files {
+		sf := files[fi]
+		types := sf.declaredTypes
+		graph := sf.embeddingGraph
 
 		// Track if we've seen the input Struct type
 		for _, t := range types {
+			if t.Name == options.StructType && structDir == "" {
+				structPkg = t.Package
+				structDir = filepath.Dir(f)
+			}
 			if _, ok := tset[t.Fullname()]; !ok {
 				allDeclaredTypes = append(allDeclaredTypes, t)
 				tset[t.Fullname()] = struct{}{}
@@ -606,15 +890,12 @@ func Make(options MakeOptions) ([]byte, error) {
 
 	// Validate at least one file contains the input struct Type
 	if !validateStructType(allDeclaredTypes, options.StructType) {
-		return []byte{},
+		return nil,
 			fmt.Errorf("%q structtype not found in input files",
 				options.StructType)
 	}
 
-	excludedMethods := make(map[string]struct{}, len(options.ExcludeMethods))
-	for _, mName := range options.ExcludeMethods {
-		excludedMethods[mName] = struct{}{}
-	}
+	excludedMethods := excludedSet(options)
 
 	embeddedStructNamesSet := make(map[string]struct{})
 	queue := []string{options.StructType}
@@ -631,35 +912,76 @@ func Make(options MakeOptions) ([]byte, error) {
 		}
 	}
 
-	// Second pass to build up the interface
-	for _, f := range options.Files {
-		src, err := os.ReadFile(f)
-		if err != nil {
-			return nil, err
+	// Second pass to build up the interface. Files are processed
+	// concurrently and merged in order to keep the output stable.
+	type structResult struct {
+		methods    []Method
+		promoted   []localMethod
+		imports    []string
+		typeDoc    string
+		typeParams string
+	}
+	results := make([]structResult, len(files))
+	_ = parallel(len(files), options.Workers, func(i int) error {
+		r := &results[i]
+		r.methods, r.imports, r.typeDoc, r.typeParams = parseStruct(files[i], options.StructType, options.CopyDocs, options.CopyTypeDoc, options.PkgName, allDeclaredTypes, options.ImportModule, options.WithNotExported, nil, false)
+		if options.WithPromoted {
+			r.promoted = receiverMethods(files[i], embeddedStructNamesSet, options, allDeclaredTypes)
 		}
-		methods, imports, parsedTypeDoc, parsedParams := ParseStruct(src, options.StructType, options.CopyDocs, options.CopyTypeDoc, options.PkgName, allDeclaredTypes, options.ImportModule, options.WithNotExported, embeddedStructNamesSet, options.WithPromoted)
-		for _, m := range methods {
+		return nil
+	})
+	var locals []localMethod
+	for _, r := range results {
+		locals = append(locals, r.promoted...)
+		for _, m := range r.methods {
 			if _, ok := excludedMethods[m.Name]; ok {
 				continue
 			}
 
 			// Use m.Name as the key to ensure uniqueness of methods in mset.
 			if _, ok := mset[m.Name]; !ok {
-				allMethods = append(allMethods, m.Lines()...)
+				allMethods = append(allMethods, m)
 				mset[m.Name] = struct{}{}
 			}
 		}
-		for _, i := range imports {
+		for _, i := range r.imports {
 			if _, ok := iset[i]; !ok {
 				allImports = append(allImports, i)
 				iset[i] = struct{}{}
 			}
 		}
 		if typeDoc == "" {
-			typeDoc = parsedTypeDoc
+			typeDoc = r.typeDoc
 		}
 		if ifaceParams == "" {
-			ifaceParams = parsedParams
+			ifaceParams = r.typeParams
+		}
+	}
+
+	// Promoted methods come last, unless they are shadowed by the ones
+	// of the struct.
+	var warnings []string
+	if options.WithPromoted {
+		p, it := c.newPromoter(files, locals, allDeclaredTypes, options, allImports)
+		methods, embeds, warns, err := p.promoted(options.StructType, allMethods)
+		if err != nil {
+			return nil, err
+		}
+		allEmbeds, warnings = embeds, warns
+		for _, m := range methods {
+			if _, ok := excludedMethods[m.Name]; ok {
+				continue
+			}
+			if _, ok := mset[m.Name]; !ok {
+				allMethods = append(allMethods, m)
+				mset[m.Name] = struct{}{}
+			}
+		}
+		for _, i := range it.specs {
+			if _, ok := iset[i]; !ok {
+				allImports = append(allImports, i)
+				iset[i] = struct{}{}
+			}
 		}
 	}
 
@@ -667,10 +989,29 @@ func Make(options MakeOptions) ([]byte, error) {
 		options.IfaceComment = fmt.Sprintf("%s\n%s", options.IfaceComment, typeDoc)
 	}
 
-	result, err := MakeInterface(options.Comment, options.PkgName, options.IfaceName, options.IfaceComment, ifaceParams, allMethods, allImports)
-	if err != nil {
+	iface := &Interface{
+		Comment:      options.Comment,
+		PkgName:      options.PkgName,
+		IfaceName:    options.IfaceName,
+		IfaceComment: options.IfaceComment,
+		TypeParams:   ifaceParams,
+		Embeds:       allEmbeds,
+		Methods:      allMethods,
+		Warnings:     warnings,
+		Imports:      allImports,
+		StructName:   options.StructType,
+		StructPkg:    structPkg,
+		importModule: options.ImportModule,
+		pkgPath:      options.PkgPath,
+		structDir:    structDir,
+		// Only struct types are recorded in the embedding graph.
+		IsStruct: isStructType(fullEmbeddingGraph, options.StructType),
+	}
+	// Every type of the source package in the signatures needs its import
+	// path, which is looked up once through go.mod.
+	iface.StructPath, iface.structPathErr = ImportPathOfDir(structDir)
+	if err := iface.parseSignatures(options.Workers); err != nil {
 		return nil, err
 	}
-
-	return result, nil
+	return iface, nil
 }
@@ -6,9 +6,12 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
+	"golang.org/x/tools/go/packages"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -133,7 +136,8 @@ func TestLines(t *testing.T) {
 }
 
 func TestParseDeclaredTypes(t *testing.T) {
-	declaredTypes := ParseDeclaredTypes(src)
+	declaredTypes, err := ParseDeclaredTypes("src.go", src)
+	require.NoError(t, err)
 
 	require.Equal(t, declaredType{
 		Name:    "Person",
@@ -154,7 +158,8 @@ type (
     First int
     Second string
 )`)
-	types := ParseDeclaredTypes(multiSrc)
+	types, err := ParseDeclaredTypes("src.go", multiSrc)
+	require.NoError(t, err)
 	require.Equal(t, []declaredType{
 		{Name: "First", Package: "main"},
 		{Name: "Second", Package: "main"},
@@ -162,7 +167,8 @@ type (
 }
 
 func TestParseEmbeddingGraph(t *testing.T) {
-	callGraph := ParseEmbeddingGraph(src)
+	callGraph, err := ParseEmbeddingGraph("src.go", src)
+	require.NoError(t, err)
 	require.Equal(t, "Person", callGraph["Turing"][0])
 }
 
@@ -174,9 +180,10 @@ type MyStruct struct {
     otherpkg.External
     *otherpkg.Pointer
 }`)
-	graph := ParseEmbeddingGraph(extSrc)
+	graph, err := ParseEmbeddingGraph("src.go", extSrc)
+	require.NoError(t, err)
 	require.Contains(t, graph, "MyStruct")
-	require.ElementsMatch(t, []string{"External", "Pointer"}, graph["MyStruct"])
+	require.ElementsMatch(t, []string{"otherpkg.External", "otherpkg.Pointer"}, graph["MyStruct"])
 }
 
 // Verify embedded generic struct instantiations are detected.
@@ -186,7 +193,8 @@ type Generic[T any] struct{}
 type MyStruct struct {
        Generic[int]
 }`)
-	graph := ParseEmbeddingGraph(src)
+	graph, err := ParseEmbeddingGraph("src.go", src)
+	require.NoError(t, err)
 	require.Contains(t, graph, "MyStruct")
 	require.ElementsMatch(t, []string{"Generic"}, graph["MyStruct"])
 }
@@ -198,13 +206,15 @@ type Generic[T any] struct{}
 type MyStruct struct {
        *Generic[int]
 }`)
-	graph := ParseEmbeddingGraph(src)
+	graph, err := ParseEmbeddingGraph("src.go", src)
+	require.NoError(t, err)
 	require.Contains(t, graph, "MyStruct")
 	require.ElementsMatch(t, []string{"Generic"}, graph["MyStruct"])
 }
 
 func TestParseStruct(t *testing.T) {
-	methods, imports, typeDoc, _ := ParseStruct(src, "Person", true, true, "", nil, "", false, nil, false)
+	methods, imports, typeDoc, _, err := ParseStruct("src.go", src, "Person", true, true, "", nil, "", false, nil, false)
+	require.NoError(t, err)
 
 	require.Equal(t, "Name() (string)", methods[0].Code)
 
@@ -216,7 +226,8 @@ func TestParseStruct(t *testing.T) {
 }
 
 func TestParseStructWithImportModule(t *testing.T) {
-	methods, imports, typeDoc, _ := ParseStruct(src, "Person", true, true, "", nil, "github.com/test/test", false, nil, false)
+	methods, imports, typeDoc, _, err := ParseStruct("src.go", src, "Person", true, true, "", nil, "github.com/test/test", false, nil, false)
+	require.NoError(t, err)
 
 	require.Equal(t, "Name() (string)", methods[0].Code)
 
@@ -229,7 +240,8 @@ func TestParseStructWithImportModule(t *testing.T) {
 }
 
 func TestParseStructWithNotExported(t *testing.T) {
-	methods, _, _, _ := ParseStruct(src, "Person", true, true, "", nil, "github.com/test/test", true, nil, false)
+	methods, _, _, _, err := ParseStruct("src.go", src, "Person", true, true, "", nil, "github.com/test/test", true, nil, false)
+	require.NoError(t, err)
 
 	var oneExists, twoExists bool
 	for _, method := range methods {
@@ -250,7 +262,8 @@ func TestParseStructWithPromoted(t *testing.T) {
 	callGraph := map[string]struct{}{
 		"Person": {},
 	}
-	methods, imports, typeDoc, _ := ParseStruct(src, "Turing", true, true, "", nil, "", false, callGraph, true)
+	methods, imports, typeDoc, _, err := ParseStruct("src.go", src, "Turing", true, true, "", nil, "", false, callGraph, true)
+	require.NoError(t, err)
 	t.Log(methods)
 	t.Log(imports)
 	t.Log(typeDoc)
@@ -265,7 +278,8 @@ func TestParseStructWithPromoted(t *testing.T) {
 }
 
 func TestParseStructWithDirective(t *testing.T) {
-	methods, imports, typeDoc, _ := ParseStruct(src, "DirectedStruct", true, true, "", nil, "", false, nil, false)
+	methods, imports, typeDoc, _, err := ParseStruct("src.go", src, "DirectedStruct", true, true, "", nil, "", false, nil, false)
+	require.NoError(t, err)
 	t.Log(methods)
 	t.Log(imports)
 	t.Log(typeDoc)
@@ -281,7 +295,6 @@ func TestParseStructWithDirective(t *testing.T) {
 	require.Equal(t, "This is a Struct with a go:generate directive.", typeDoc)
 }
 
-
 func TestGetReceiverTypeName(t *testing.T) {
 	fset := token.NewFileSet()
 	a, err := parser.ParseFile(fset, "", src, parser.ParseComments)
@@ -356,7 +369,8 @@ func TestFormatFieldList(t *testing.T) {
 }
 
 func TestNoCopyTypeDocs(t *testing.T) {
-	_, _, typeDoc, _ := ParseStruct(src, "Person", true, false, "", nil, "", false, nil, false)
+	_, _, typeDoc, _, err := ParseStruct("src.go", src, "Person", true, false, "", nil, "", false, nil, false)
+	require.NoError(t, err)
 	require.Equal(t, "", typeDoc)
 }
 
@@ -596,7 +610,8 @@ func TestMakeFileNotFound(t *testing.T) {
 // TestParseDeclaredTypesEmpty ensures that a source with no type declarations returns an empty slice.
 func TestParseDeclaredTypesEmpty(t *testing.T) {
 	src := []byte("package main\nfunc Foo() {}")
-	types := ParseDeclaredTypes(src)
+	types, err := ParseDeclaredTypes("src.go", src)
+	require.NoError(t, err)
 	require.Empty(t, types)
 }
 
@@ -1067,41 +1082,67 @@ func (s *Sub) Foo() int { return 0 }
 	require.NotContains(t, outStr, "Foo() string")
 }
 
-// TestParseDeclaredTypes_Fatal runs ParseDeclaredTypes with invalid Go code.
-// Because ParseDeclaredTypes calls log.Fatal on parse errors, we run this in a subprocess.
-func TestParseDeclaredTypes_Fatal(t *testing.T) {
-	if os.Getenv("BE_CRASHER") == "1" {
-		// Provide invalid Go source to force a parse error
-		ParseDeclaredTypes([]byte("invalid go code"))
-		// This point should not be reached because log.Fatal should exit.
-		return
-	}
-	// Re-run this test in a subprocess so that the os.Exit call can be observed.
-	cmd := exec.Command(os.Args[0], "-test.run=TestParseDeclaredTypes_Fatal")
-	cmd.Env = append(os.Environ(), "BE_CRASHER=1")
-	err := cmd.Run()
-	// An exit error is expected due to log.Fatal.
-	if exitErr, ok := err.(*exec.ExitError); ok && !exitErr.Success() {
-		return // Test passed.
-	}
-	t.Fatalf("ParseDeclaredTypes did not exit as expected")
+// TestParseDeclaredTypes_Error runs ParseDeclaredTypes with invalid Go code
+// and checks the position reported by the returned *ParseError.
+func TestParseDeclaredTypes_Error(t *testing.T) {
+	_, err := ParseDeclaredTypes("broken.go", []byte("package main\n\nfunc {"))
+	var pe *ParseError
+	require.ErrorAs(t, err, &pe)
+	require.Equal(t, "broken.go", pe.File)
+	require.Equal(t, 3, pe.Line)
+	require.Equal(t, 6, pe.Column)
+	require.Equal(t, "", pe.Struct)
+	require.True(t, strings.HasPrefix(err.Error(), "broken.go:3:6: "), err.Error())
+}
+
+// TestParseStruct_Error runs ParseStruct with invalid Go source and checks
+// that the failing struct is reported.
+func TestParseStruct_Error(t *testing.T) {
+	_, _, _, _, err := ParseStruct("broken.go", []byte("invalid go code"), "Foo", true, true, "", nil, "", false, nil, false)
+	var pe *ParseError
+	require.ErrorAs(t, err, &pe)
+	require.Equal(t, "broken.go", pe.File)
+	require.Equal(t, 1, pe.Line)
+	require.Equal(t, 1, pe.Column)
+	require.Equal(t, "Foo", pe.Struct)
+	require.Contains(t, err.Error(), "(struct Foo)")
+}
+
+func TestMake_ParseError(t *testing.T) {
+	tmp, err := os.CreateTemp("", "broken_*.go")
+	require.NoError(t, err)
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	_, err = tmp.WriteString("package main\ntype A struct{\nfunc")
+	require.NoError(t, err)
+	require.NoError(t, tmp.Close())
+
+	_, err = Make(MakeOptions{Files: []string{tmp.Name()}, StructType: "A", PkgName: "main", IfaceName: "I"})
+	var pe *ParseError
+	require.ErrorAs(t, err, &pe)
+	require.Equal(t, tmp.Name(), pe.File)
+	require.Equal(t, 3, pe.Line)
+	require.Equal(t, "A", pe.Struct)
 }
 
-// TestParseStruct_Fatal runs ParseStruct with invalid Go source.
-// Since ParseStruct calls log.Fatal on parse errors, we capture that via a subprocess.
-func TestParseStruct_Fatal(t *testing.T) {
-	if os.Getenv("BE_CRASHER") == "1" {
-		// Provide invalid source code to trigger parser.ParseFile error inside ParseStruct.
-		ParseStruct([]byte("invalid go code"), "Foo", true, true, "", nil, "", false, nil, false)
-		return
-	}
-	cmd := exec.Command(os.Args[0], "-test.run=TestParseStruct_Fatal")
-	cmd.Env = append(os.Environ(), "BE_CRASHER=1")
-	err := cmd.Run()
-	if exitErr, ok := err.(*exec.ExitError); ok && !exitErr.Success() {
-		return // Test passed.
-	}
-	t.Fatalf("ParseStruct did not exit as expected")
+func TestParseErrorFromPackage(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"b/b.go": "package b\n\ntype B struct{}\n\nfunc (b *B) F() int { return \"\" }\n",
+	})
+
+	_, err := Make(MakeOptions{Package: "./b", Dir: dir, StructType: "B", PkgName: "b", IfaceName: "I"})
+	var pe *ParseError
+	require.ErrorAs(t, err, &pe)
+	require.Equal(t, filepath.Join(dir, "b", "b.go"), pe.File)
+	require.Equal(t, 5, pe.Line)
+	require.Equal(t, 30, pe.Column)
+	require.Equal(t, "B", pe.Struct)
+
+	pe = packageError(packages.Error{Msg: "boom"}, "").(*ParseError)
+	require.Equal(t, "boom", pe.Error())
+	pe = packageError(packages.Error{Pos: `C:\src\a.go:4`, Msg: "boom"}, "").(*ParseError)
+	require.Equal(t, `C:\src\a.go`, pe.File)
+	require.Equal(t, 4, pe.Line)
+	require.Equal(t, 0, pe.Column)
 }
 
 func TestGenericsSupport(t *testing.T) {
@@ -1113,7 +1154,8 @@ func (b *Box[T]) Add(v T) {}
 func (b *Box[T]) Get() T { var zero T; return zero }
 `)
 
-	methods, _, _, typeParams := ParseStruct(src, "Box", true, true, "generic", nil, "", false, nil, false)
+	methods, _, _, typeParams, err := ParseStruct("src.go", src, "Box", true, true, "generic", nil, "", false, nil, false)
+	require.NoError(t, err)
 	require.Equal(t, "[T any]", typeParams)
 	require.Equal(t, "Add(v T)", methods[0].Code)
 	require.Equal(t, "Get() (T)", methods[1].Code)
@@ -1155,8 +1197,10 @@ type Example[T any] struct{}
 func (e *Example[T]) Use(g Generic[T]) {}
 `)
 
-	types := ParseDeclaredTypes(src)
-	methods, _, _, _ := ParseStruct(src, "Example", true, true, "bar", types, "", false, nil, false)
+	types, err := ParseDeclaredTypes("src.go", src)
+	require.NoError(t, err)
+	methods, _, _, _, err := ParseStruct("src.go", src, "Example", true, true, "bar", types, "", false, nil, false)
+	require.NoError(t, err)
 
 	require.Equal(t, "Use(g foo.Generic[T])", methods[0].Code)
 }
@@ -1169,22 +1213,17 @@ func TestGetTypeDeclarationName_NonTypeSpec(t *testing.T) {
 
 func TestParseEmbeddingGraph_NonStruct(t *testing.T) {
 	src := []byte("package main\ntype Alias int")
-	graph := ParseEmbeddingGraph(src)
+	graph, err := ParseEmbeddingGraph("src.go", src)
+	require.NoError(t, err)
 	require.Empty(t, graph)
 }
 
 func TestParseEmbeddingGraph_ParseError(t *testing.T) {
-	if os.Getenv("BE_PEG_CRASHER") == "1" {
-		ParseEmbeddingGraph([]byte("invalid"))
-		return
-	}
-	cmd := exec.Command(os.Args[0], "-test.run=TestParseEmbeddingGraph_ParseError")
-	cmd.Env = append(os.Environ(), "BE_PEG_CRASHER=1")
-	err := cmd.Run()
-	if exitErr, ok := err.(*exec.ExitError); ok && !exitErr.Success() {
-		return
-	}
-	t.Fatalf("ParseEmbeddingGraph did not exit as expected")
+	_, err := ParseEmbeddingGraph("invalid.go", []byte("invalid"))
+	var pe *ParseError
+	require.ErrorAs(t, err, &pe)
+	require.Equal(t, "invalid.go", pe.File)
+	require.Equal(t, 1, pe.Line)
 }
 
 func TestMake_DuplicateEmbeddedStructs(t *testing.T) {
@@ -1251,7 +1290,8 @@ func TestParseStruct_DuplicateMethod(t *testing.T) {
 type Foo struct{}
 func (f *Foo) Bar() {}
 func (f *Foo) Bar() {}`)
-	methods, _, _, _ := ParseStruct(src, "Foo", true, true, "main", nil, "", false, nil, false)
+	methods, _, _, _, err := ParseStruct("src.go", src, "Foo", true, true, "main", nil, "", false, nil, false)
+	require.NoError(t, err)
 	count := 0
 	for _, m := range methods {
 		if strings.HasPrefix(m.Code, "Bar(") {
@@ -1306,3 +1346,2478 @@ func Foo(x (MyType)) {}`)
 	require.Len(t, params, 1)
 	require.Equal(t, "x (other.MyType)", params[0])
 }
+
+// writeTestModule creates a throwaway module in a temporary directory with
+// the given files (relative path -> content) and returns its root.
+func writeTestModule(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	files["go.mod"] = "module example.com/mod\n\ngo 1.22\n"
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), os.ModePerm))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+	}
+	return dir
+}
+
+func TestMakeFromPackage(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"store/model.go": `package store
+
+type User struct{}
+
+type ID = string
+`,
+		"store/store.go": `package store
+
+import (
+	"context"
+	stdio "io"
+	"time"
+)
+
+// Store keeps users.
+type Store struct {
+	Base
+}
+
+// Get returns a user.
+//
+//go:noinline
+func (s *Store) Get(ctx context.Context, id ID) (*User, error) { return nil, nil }
+
+func (s *Store) Put(ctx context.Context, a, b *User, ttl time.Duration) error { return nil }
+
+func (s Store) Dump(w stdio.Writer, opts ...string) {}
+
+func (s *Store) helper() {}
+
+type Base struct{}
+
+// Close closes the store.
+func (b *Base) Close() error { return nil }
+`,
+	})
+
+	result, err := Make(MakeOptions{
+		Package:      "./store",
+		Dir:          dir,
+		StructType:   "Store",
+		Comment:      "Test Comment",
+		PkgName:      "gen",
+		IfaceName:    "StoreIface",
+		IfaceComment: "StoreIface ...",
+		CopyDocs:     true,
+		CopyTypeDoc:  true,
+		WithPromoted: true,
+	})
+	require.NoError(t, err)
+	expected := `// Test Comment
+
+package gen
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"example.com/mod/store"
+)
+
+// StoreIface ...
+// Store keeps users.
+type StoreIface interface {
+	// Get returns a user.
+	//
+	Get(ctx context.Context, id store.ID) (*store.User, error)
+	Put(ctx context.Context, a, b *store.User, ttl time.Duration) error
+	Dump(w io.Writer, opts ...string)
+	// Close closes the store.
+	Close() error
+}
+`
+	require.Equal(t, expected, string(result))
+}
+
+func TestMakeFromPackageGenericSamePackage(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"box/box.go": `package box
+
+type Box[T comparable, V any] struct{}
+
+func (b *Box[K, U]) Put(k K, v U) {}
+func (b *Box[K, U]) Get(k K) (U, bool) { var zero U; return zero, false }
+`,
+	})
+
+	result, err := Make(MakeOptions{
+		Package:    "./box",
+		Dir:        dir,
+		StructType: "Box",
+		Comment:    "Test Comment",
+		PkgName:    "box",
+		IfaceName:  "BoxIface",
+	})
+	require.NoError(t, err)
+	expected := `// Test Comment
+
+package box
+
+type BoxIface[T comparable, V any] interface {
+	Put(k T, v V)
+	Get(k T) (V, bool)
+}
+`
+	require.Equal(t, expected, string(result))
+}
+
+func TestMakeFromPackageSameName(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"store/item.go": "package store\n\ntype Item struct{}\n",
+		"svc/svc.go": `package svc
+
+import "example.com/mod/store"
+
+type Svc struct{}
+
+func (s *Svc) Get() *store.Item { return nil }
+`,
+	})
+	options := MakeOptions{Package: "./svc", Dir: dir, StructType: "Svc", PkgName: "store", IfaceName: "Svc"}
+
+	// Another package with the name of the generated one is still imported.
+	iface, err := Analyze(options)
+	require.NoError(t, err)
+	require.Equal(t, "Get() (*store.Item)", iface.Methods[0].Code)
+	require.Equal(t, []string{`"example.com/mod/store"`}, iface.Imports)
+
+	options.PkgPath = "example.com/mod/store"
+	iface, err = Analyze(options)
+	require.NoError(t, err)
+	require.Equal(t, "Get() (*Item)", iface.Methods[0].Code)
+	require.Empty(t, iface.Imports)
+}
+
+func TestMakeFromPackageErrors(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"a/a.go": "package a\n\ntype A struct{}\n",
+		"b/b.go": "package b\n\nfunc F() int { return \"\" }\n",
+	})
+
+	_, err := Make(MakeOptions{Package: "./a", Dir: dir, StructType: "Missing", PkgName: "a", IfaceName: "I"})
+	require.ErrorContains(t, err, `"Missing" structtype not found`)
+
+	_, err = Make(MakeOptions{Package: "./b", Dir: dir, StructType: "B", PkgName: "b", IfaceName: "I"})
+	require.Error(t, err)
+
+	_, err = Make(MakeOptions{Package: "./...", Dir: dir, StructType: "A", PkgName: "a", IfaceName: "I"})
+	require.ErrorContains(t, err, "expected exactly one")
+}
+
+func TestSplitTypeRef(t *testing.T) {
+	for ref, want := range map[string][2]string{
+		"database/sql.DB":                     {"database/sql", "DB"},
+		"*net/http.Client":                    {"net/http", "Client"},
+		"github.com/redis/go-redis/v9.Client": {"github.com/redis/go-redis/v9", "Client"},
+		"gopkg.in/yaml.v3.Node":               {"gopkg.in/yaml.v3", "Node"},
+		"strings.Builder":                     {"strings", "Builder"},
+	} {
+		pkgPath, typeName, err := SplitTypeRef(ref)
+		require.NoError(t, err, ref)
+		require.Equal(t, want[0], pkgPath, ref)
+		require.Equal(t, want[1], typeName, ref)
+	}
+
+	for _, ref := range []string{"Builder", "example.com/pkg", "strings."} {
+		_, _, err := SplitTypeRef(ref)
+		require.Error(t, err, ref)
+	}
+}
+
+func TestMakeFromType(t *testing.T) {
+	result, err := Make(MakeOptions{
+		Type:      "strings.Builder",
+		Comment:   "Test Comment",
+		PkgName:   "gen",
+		IfaceName: "Builder",
+	})
+	require.NoError(t, err)
+	expected := `// Test Comment
+
+package gen
+
+type Builder interface {
+	String() string
+	Len() int
+	Cap() int
+	Reset()
+	Grow(n int)
+	Write(p []byte) (int, error)
+	WriteByte(c byte) error
+	WriteRune(r rune) (int, error)
+	WriteString(s string) (int, error)
+}
+`
+	require.Equal(t, expected, string(result))
+}
+
+func TestMakeFromTypePromotedAcrossPackages(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"base/base.go": `package base
+
+import "io"
+
+type Repo struct{}
+
+func (r *Repo) Source() io.Reader { return nil }
+`,
+		"svc/svc.go": `package svc
+
+import (
+	"sync"
+
+	"example.com/mod/base"
+)
+
+type Svc struct {
+	sync.Mutex
+	*base.Repo
+}
+
+func (s *Svc) Name() string { return "" }
+`,
+	})
+
+	result, err := Make(MakeOptions{
+		Type:      "example.com/mod/svc.Svc",
+		Dir:       dir,
+		Comment:   "Test Comment",
+		PkgName:   "gen",
+		IfaceName: "Svc",
+	})
+	require.NoError(t, err)
+	out := string(result)
+	require.Contains(t, out, "\tName() string\n")
+	require.Contains(t, out, "\tLock()\n")
+	require.Contains(t, out, "\tTryLock() bool\n")
+	require.Contains(t, out, "\tUnlock()\n")
+	require.Contains(t, out, "\tSource() io.Reader\n")
+	require.Contains(t, out, "\"io\"")
+	require.NotContains(t, out, "example.com/mod")
+
+	_, err = Make(MakeOptions{Type: "strings", PkgName: "gen", IfaceName: "I"})
+	require.Error(t, err)
+}
+
+func TestMakeAll(t *testing.T) {
+	src := []byte(`package main
+type A struct{}
+func (a *A) Foo() {}
+type B struct{}
+func (b *B) Bar() int { return 0 }`)
+	tmp, err := os.CreateTemp("", "makeall_*.go")
+	require.NoError(t, err)
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	_, err = tmp.Write(src)
+	require.NoError(t, err)
+	require.NoError(t, tmp.Close())
+
+	results, err := MakeAll([]MakeOptions{
+		{Files: []string{tmp.Name()}, StructType: "A", Comment: "c", PkgName: "main", IfaceName: "AIface"},
+		{Files: []string{tmp.Name()}, StructType: "B", Comment: "c", PkgName: "main", IfaceName: "BIface"},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Contains(t, string(results[0]), "type AIface interface {\n\tFoo()\n}")
+	require.Contains(t, string(results[1]), "type BIface interface {\n\tBar() int\n}")
+
+	_, err = MakeAll([]MakeOptions{
+		{Files: []string{tmp.Name()}, StructType: "A", Comment: "c", PkgName: "main", IfaceName: "AIface"},
+		{Files: []string{tmp.Name()}, StructType: "C", Comment: "c", PkgName: "main", IfaceName: "CIface"},
+	})
+	require.ErrorContains(t, err, "interface CIface")
+}
+
+func TestGeneratorSharesFiles(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.go")
+	b := filepath.Join(dir, "b.go")
+	require.NoError(t, os.WriteFile(a, []byte(`package main
+
+// Box holds a value.
+type Box[T any] struct{ Inner }
+
+// Get returns the value.
+func (b *Box[T]) Get() T { var v T; return v }
+`), 0o644))
+	require.NoError(t, os.WriteFile(b, []byte(`package main
+
+type Inner struct{}
+
+// Reset clears the value.
+func (i *Inner) Reset(keep bool) {}
+`), 0o644))
+
+	g := NewGenerator()
+	for range 2 {
+		result, err := g.Make(MakeOptions{Files: []string{a, b}, StructType: "Box", Comment: "c", PkgName: "main", IfaceName: "Boxer", CopyDocs: true, CopyTypeDoc: true, WithPromoted: true})
+		require.NoError(t, err)
+		require.Equal(t, `// c
+
+package main
+
+// Box holds a value.
+type Boxer[T any] interface {
+	// Get returns the value.
+	Get() T
+	// Reset clears the value.
+	Reset(keep bool)
+}
+`, string(result))
+	}
+
+	// Every file is parsed once into the shared FileSet.
+	require.Len(t, g.cache.files, 2)
+	var files int
+	g.cache.fset.Iterate(func(*token.File) bool {
+		files++
+		return true
+	})
+	require.Equal(t, 2, files)
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "src.go")
+	require.NoError(t, os.WriteFile(srcPath, []byte(`package main
+type A struct{}
+func (a *A) Foo() {}
+func (a *A) Bar() {}`), 0o644))
+
+	options := MakeOptions{Files: []string{srcPath}, StructType: "A", Comment: "c", PkgName: "main", IfaceName: "I"}
+	result, err := Make(options)
+	require.NoError(t, err)
+
+	outPath := filepath.Join(dir, "iface.go")
+	require.NoError(t, os.WriteFile(outPath, result, 0o644))
+	require.NoError(t, Check(options, outPath))
+
+	require.NoError(t, os.WriteFile(outPath, []byte(strings.Replace(string(result), "\tBar()\n", "", 1)), 0o644))
+	err = Check(options, outPath)
+	var se *StaleError
+	require.ErrorAs(t, err, &se)
+	require.Equal(t, outPath, se.File)
+	require.Equal(t, "A", se.Struct)
+	require.Contains(t, se.Diff, "--- "+outPath+"\n")
+	require.Contains(t, se.Diff, "+++ "+outPath+" (generated)\n")
+	require.Contains(t, se.Diff, "\n \tFoo()\n+\tBar()\n")
+
+	err = Check(options, filepath.Join(dir, "missing.go"))
+	require.ErrorAs(t, err, &se)
+	require.Contains(t, se.Diff, "+type I interface {\n")
+
+	err = CheckAll([]MakeOptions{options, options}, []string{outPath, filepath.Join(dir, "missing.go")})
+	require.ErrorContains(t, err, outPath+" is out of date")
+	require.ErrorContains(t, err, "missing.go is out of date")
+
+	require.Error(t, CheckAll([]MakeOptions{options}, nil))
+}
+
+func TestMakeMock(t *testing.T) {
+	src := []byte(`package store
+
+import (
+	"context"
+	"io"
+)
+
+type Store[T any] struct{}
+
+func (s *Store[T]) Get(ctx context.Context, id string) (T, error) { var z T; return z, nil }
+func (s *Store[T]) Close() {}
+func (s *Store[T]) Dump(w io.Writer, prefix string, keys ...string) int { return 0 }
+`)
+	tmp, err := os.CreateTemp("", "mock_*.go")
+	require.NoError(t, err)
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	_, err = tmp.Write(src)
+	require.NoError(t, err)
+	require.NoError(t, tmp.Close())
+
+	result, err := MakeMock(MakeOptions{
+		Files:          []string{tmp.Name()},
+		StructType:     "Store",
+		Comment:        "Test Comment",
+		PkgName:        "store",
+		IfaceName:      "StoreIface",
+		ExcludeMethods: []string{"Close"},
+	})
+	require.NoError(t, err)
+	expected := `// Test Comment
+
+package store
+
+import (
+	"context"
+	"io"
+	"reflect"
+
+	"go.uber.org/mock/gomock"
+)
+
+// MockStoreIface is a mock of StoreIface interface.
+type MockStoreIface[T any] struct {
+	ctrl     *gomock.Controller
+	recorder *MockStoreIfaceMockRecorder[T]
+}
+
+// MockStoreIfaceMockRecorder is the mock recorder for MockStoreIface.
+type MockStoreIfaceMockRecorder[T any] struct {
+	mock *MockStoreIface[T]
+}
+
+// NewMockStoreIface creates a new mock instance.
+func NewMockStoreIface[T any](ctrl *gomock.Controller) *MockStoreIface[T] {
+	mock := &MockStoreIface[T]{ctrl: ctrl}
+	mock.recorder = &MockStoreIfaceMockRecorder[T]{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockStoreIface[T]) EXPECT() *MockStoreIfaceMockRecorder[T] {
+	return m.recorder
+}
+
+// Get mocks base method.
+func (m *MockStoreIface[T]) Get(arg0 context.Context, arg1 string) (T, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", arg0, arg1)
+	ret0, _ := ret[0].(T)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockStoreIfaceMockRecorder[T]) Get(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockStoreIface[T])(nil).Get), arg0, arg1)
+}
+
+// Dump mocks base method.
+func (m *MockStoreIface[T]) Dump(arg0 io.Writer, arg1 string, arg2 ...string) int {
+	m.ctrl.T.Helper()
+	varargs := []any{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Dump", varargs...)
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// Dump indicates an expected call of Dump.
+func (mr *MockStoreIfaceMockRecorder[T]) Dump(arg0, arg1 any, arg2 ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Dump", reflect.TypeOf((*MockStoreIface[T])(nil).Dump), varargs...)
+}
+`
+	require.Equal(t, expected, string(result))
+}
+
+func TestMakeMockCode(t *testing.T) {
+	methods := []Method{
+		{Name: "Close", Code: "Close() (error)", Results: []Param{{Type: "error"}}},
+		{Name: "Log", Code: "Log(args ...any)", Params: []Param{{Name: "args", Type: "any", Variadic: true}}},
+	}
+	result, err := MakeMockCode("c", "pkg", "Closer", "", methods, []string{`"reflect"`})
+	require.NoError(t, err)
+	out := string(result)
+	require.Equal(t, 1, strings.Count(out, `"reflect"`))
+	require.Contains(t, out, "func (m *MockCloser) Close() error {\n")
+	require.Contains(t, out, "\tret0, _ := ret[0].(error)\n")
+	require.Contains(t, out, "func (mr *MockCloserMockRecorder) Close() *gomock.Call {\n")
+	require.Contains(t, out, "func (m *MockCloser) Log(arg0 ...any) {\n")
+	require.Contains(t, out, "\tvarargs := []any{}\n")
+	require.Contains(t, out, "func (mr *MockCloserMockRecorder) Log(arg0 ...any) *gomock.Call {\n")
+
+	// The signatures come from Params and Results, not from Code.
+	result, err = MakeMockCode("c", "pkg", "Getter", "", []Method{{Name: "Get", Code: "Bad((", Params: []Param{{Name: "id", Type: "int"}}, Results: []Param{{Type: "string"}}}}, nil)
+	require.NoError(t, err)
+	require.Contains(t, string(result), "func (m *MockGetter) Get(arg0 int) string {\n")
+
+	// Without them, the signatures are parsed from Code.
+	result, err = MakeMockCode("c", "pkg", "Getter", "", []Method{{Name: "Get", Code: "Get(id int, opts ...string) (string, error)"}, {Name: "Reset", Code: "Reset()"}}, nil)
+	require.NoError(t, err)
+	require.Contains(t, string(result), "func (m *MockGetter) Get(arg0 int, arg1 ...string) (string, error) {\n")
+	require.Contains(t, string(result), "func (m *MockGetter) Reset() {\n")
+	_, err = MakeMockCode("c", "pkg", "Getter", "", []Method{{Name: "Get", Code: "Get(("}}, nil)
+	require.ErrorContains(t, err, `invalid method "Get(("`)
+	_, err = MakeMockCode("c", "pkg", "Closer", "[T", nil, nil)
+	require.Error(t, err)
+	_, err = MakeMock(MakeOptions{Files: []string{"/no/such/file.go"}, StructType: "A", PkgName: "p", IfaceName: "I"})
+	require.Error(t, err)
+}
+
+func TestMakeAssert(t *testing.T) {
+	tmp, err := os.CreateTemp("", "assert_*.go")
+	require.NoError(t, err)
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	_, err = tmp.WriteString(`package main
+type Ptr struct{}
+func (p *Ptr) Foo() {}
+func (p Ptr) Bar() {}
+type Val struct{}
+func (v Val) Foo() {}
+type Num int
+func (n Num) Foo() {}
+type Box[T any, K comparable] struct{}
+func (b *Box[T, K]) Put(k K, v T) {}
+`)
+	require.NoError(t, err)
+	require.NoError(t, tmp.Close())
+
+	for structType, want := range map[string]string{
+		"Ptr": "\nvar _ I = (*Ptr)(nil)\n",
+		"Val": "\nvar _ I = Val{}\n",
+		"Num": "\nvar _ I = *new(Num)\n",
+		"Box": "\nfunc _[T any, K comparable]() {\n\tvar _ I[T, K] = (*Box[T, K])(nil)\n}\n",
+	} {
+		result, err := Make(MakeOptions{Files: []string{tmp.Name()}, StructType: structType, Comment: "c", PkgName: "main", IfaceName: "I", Assert: true})
+		require.NoError(t, err, structType)
+		require.True(t, strings.HasSuffix(string(result), want), string(result))
+	}
+
+	_, err = Make(MakeOptions{Files: []string{tmp.Name()}, StructType: "Ptr", Comment: "c", PkgName: "other", IfaceName: "I", Assert: true})
+	require.ErrorContains(t, err, "can't reference main.Ptr from package other")
+
+	result, err := Make(MakeOptions{Files: []string{tmp.Name()}, StructType: "Ptr", Comment: "c", PkgName: "other", IfaceName: "I", Assert: true, ImportModule: "example.com/main"})
+	require.NoError(t, err)
+	require.Contains(t, string(result), "\nvar _ I = (*Ptr)(nil)\n")
+}
+
+func TestMakeAssertOtherPackage(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"store/store.go": `package store
+
+import "io"
+
+type Store struct{}
+
+func (s *Store) Open() io.Reader { return nil }
+
+func (s Store) Close() error { return nil }
+`,
+	})
+
+	// File mode resolves the import path of the struct through go.mod.
+	options := MakeOptions{Files: []string{filepath.Join(dir, "store", "store.go")}, StructType: "Store", Comment: "c", PkgName: "gen", IfaceName: "Store", Assert: true}
+	result, err := Make(options)
+	require.NoError(t, err)
+	require.Contains(t, string(result), "\t\"example.com/mod/store\"\n")
+	require.Contains(t, string(result), "\nvar _ Store = (*store.Store)(nil)\n")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "gen"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "gen", "store.go"), result, 0o644))
+	_, err = LoadPackage(dir, "./gen")
+	require.NoError(t, err)
+
+	// Package mode reuses the import of the source package.
+	result, err = Make(MakeOptions{Package: "./store", Dir: dir, StructType: "Store", Comment: "c", PkgName: "gen", IfaceName: "Store", ExcludeMethods: []string{"Open"}, Assert: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, strings.Count(string(result), `"example.com/mod/store"`))
+	require.Contains(t, string(result), "\nvar _ Store = store.Store{}\n")
+
+	// Another package with the name of the source package still imports it.
+	for _, mode := range []MakeOptions{{Files: options.Files}, {Package: "./store", Dir: dir}} {
+		mode.StructType, mode.Comment, mode.PkgName, mode.PkgPath, mode.IfaceName, mode.Assert = "Store", "c", "store", "example.com/mod/other", "StoreIface", true
+		result, err = Make(mode)
+		require.NoError(t, err)
+		require.Contains(t, string(result), "\t\"example.com/mod/store\"\n")
+		require.Contains(t, string(result), "\nvar _ StoreIface = (*store.Store)(nil)\n")
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "other"), os.ModePerm))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "other", "iface.go"), result, 0o644))
+		_, err = LoadPackage(dir, "./other")
+		require.NoError(t, err)
+	}
+
+	// Companion file in the source package.
+	result, err = MakeAssertion(options, "example.com/mod/gen")
+	require.NoError(t, err)
+	require.Equal(t, `// c
+
+package store
+
+import (
+	"example.com/mod/gen"
+)
+
+var _ gen.Store = (*Store)(nil)
+`, string(result))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "gen", "store.go"), []byte("package gen\n\ntype Store interface{ Close() error }\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "store", "assert.go"), result, 0o644))
+	_, err = LoadPackage(dir, "./store")
+	require.NoError(t, err)
+
+	options.PkgName = "store"
+	result, err = MakeAssertion(options, "example.com/mod/store")
+	require.NoError(t, err)
+	require.Equal(t, "// c\n\npackage store\n\nvar _ Store = (*Store)(nil)\n", string(result))
+}
+
+func TestImportPathOfDir(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{"a/b/c.go": "package b\n"})
+
+	p, err := ImportPathOfDir(dir)
+	require.NoError(t, err)
+	require.Equal(t, "example.com/mod", p)
+
+	p, err = ImportPathOfDir(filepath.Join(dir, "a", "b"))
+	require.NoError(t, err)
+	require.Equal(t, "example.com/mod/a/b", p)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a", "go.mod"), []byte("go 1.22\n"), 0o644))
+	_, err = ImportPathOfDir(filepath.Join(dir, "a", "b"))
+	require.ErrorContains(t, err, "no module path")
+}
+
+func TestMakeUsedBy(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"store/store.go": `package store
+
+import "io"
+
+type Store struct{}
+
+func (s *Store) Get(id string) (string, error) { return "", nil }
+
+func (s *Store) Put(id, v string) error { return nil }
+
+func (s *Store) Open() io.Reader { return nil }
+
+func (s *Store) Close() error { return nil }
+`,
+		"service/service.go": `package service
+
+import "example.com/mod/store"
+
+type Service struct {
+	db *store.Store
+}
+
+func (s *Service) Load(id string) (string, error) {
+	return s.db.Get(id)
+}
+
+func Save(db *store.Store, id string) error {
+	return (db).Put(id, "")
+}
+
+func run() {
+	var local store.Store
+	local.Close()
+}
+`,
+	})
+
+	for _, options := range []MakeOptions{
+		{Files: []string{filepath.Join(dir, "store", "store.go")}, Dir: dir},
+		{Package: "./store", Dir: dir},
+	} {
+		options.StructType = "Store"
+		options.Comment = "c"
+		options.PkgName = "gen"
+		options.IfaceName = "Store"
+		options.UsedBy = "./service"
+		result, err := Make(options)
+		require.NoError(t, err)
+		require.Equal(t, `// c
+
+package gen
+
+type Store interface {
+	Get(id string) (string, error)
+	Put(id, v string) error
+}
+`, string(result))
+	}
+
+	_, err := Make(MakeOptions{Package: "./store", Dir: dir, StructType: "Store", PkgName: "gen", IfaceName: "Store", UsedBy: "./store"})
+	require.EqualError(t, err, "no methods of store.Store are called in example.com/mod/store")
+}
+
+func TestMakeTemplate(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"store/store.go": `package store
+
+type Store struct{}
+
+// Get returns the value of id.
+func (s *Store) Get(id string, opts ...int) (v string, err error) { return "", nil }
+`,
+		"iface.tmpl": `//go:build !nostore
+
+// Copyright 2024 The Authors.
+
+// {{.Comment}}
+
+package {{.PkgName}}
+
+type {{.IfaceName}} interface {
+{{- range .Methods}}
+{{.Code}}
+{{- end}}
+}
+
+// {{.IfaceName}}Methods lists the methods of {{.StructPkg}}.{{.StructName}}.
+var {{.IfaceName}}Methods = []string{
+{{- range .Methods}}
+	"{{.Name}}({{range $i, $p := .Params}}{{if $i}}, {{end}}{{$p.Name}} {{if $p.Variadic}}...{{end}}{{$p.Type}}{{end}})",
+{{- end}}
+}
+`,
+	})
+	options := MakeOptions{Files: []string{filepath.Join(dir, "store", "store.go")}, StructType: "Store", Comment: "c", PkgName: "gen", IfaceName: "Store", IfaceComment: "Store ...", CopyDocs: true}
+
+	// The default template renders the same as MakeInterface.
+	result, err := Make(options)
+	require.NoError(t, err)
+	expected, err := MakeInterface("c", "gen", "Store", "Store ...", "", []string{"// Get returns the value of id.", "Get(id string, opts ...int) (v string, err error)"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, string(expected), string(result))
+
+	options.Template = filepath.Join(dir, "iface.tmpl")
+	result, err = Make(options)
+	require.NoError(t, err)
+	require.Equal(t, `//go:build !nostore
+
+// Copyright 2024 The Authors.
+
+// c
+
+package gen
+
+type Store interface {
+	Get(id string, opts ...int) (v string, err error)
+}
+
+// StoreMethods lists the methods of store.Store.
+var StoreMethods = []string{
+	"Get(id string, opts ...int)",
+}
+`, string(result))
+
+	options.Template = filepath.Join(dir, "missing.tmpl")
+	_, err = Make(options)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.tmpl"), []byte("{{.Missing}}"), 0o644))
+	options.Template = filepath.Join(dir, "bad.tmpl")
+	_, err = Make(options)
+	require.ErrorContains(t, err, "can't evaluate field Missing")
+}
+
+func TestAnalyze(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"store/store.go": `package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+type Option func()
+
+type Store struct{}
+
+// Query runs q.
+func (s *Store) Query(ctx context.Context, q string, opts ...Option) ([]*sql.Rows, error) {
+	return nil, nil
+}
+
+func (s Store) Stats() map[string]int { return nil }
+`,
+	})
+	expected := []Method{
+		{
+			Name:            "Query",
+			Code:            "Query(ctx context.Context, q string, opts ...store.Option) ([]*sql.Rows, error)",
+			Docs:            []string{"// Query runs q."},
+			PointerReceiver: true,
+			Params: []Param{
+				{Name: "ctx", Type: "context.Context", PkgPath: "context"},
+				{Name: "q", Type: "string"},
+				{Name: "opts", Type: "store.Option", PkgPath: "example.com/mod/store", Variadic: true},
+			},
+			Results: []Param{
+				{Type: "[]*sql.Rows", PkgPath: "database/sql"},
+				{Type: "error"},
+			},
+		},
+		{
+			Name:    "Stats",
+			Code:    "Stats() (map[string]int)",
+			Results: []Param{{Type: "map[string]int"}},
+		},
+	}
+
+	for _, options := range []MakeOptions{
+		{Files: []string{filepath.Join(dir, "store", "store.go")}},
+		{Package: "./store", Dir: dir},
+	} {
+		options.StructType = "Store"
+		options.Comment = "c"
+		options.PkgName = "gen"
+		options.IfaceName = "Store"
+		options.CopyDocs = true
+
+		iface, err := Analyze(options)
+		require.NoError(t, err)
+		require.Equal(t, "Store", iface.IfaceName)
+		require.Equal(t, "store", iface.StructPkg)
+		require.True(t, iface.IsStruct)
+		require.Equal(t, expected, iface.Methods)
+
+		// Make renders the analyzed interface.
+		result, err := Render(iface, options)
+		require.NoError(t, err)
+		made, err := Make(options)
+		require.NoError(t, err)
+		require.Equal(t, string(made), string(result))
+	}
+}
+
+func TestGeneratorConcurrent(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"store/store.go": `package store
+
+import "sync"
+
+type Store struct {
+	sync.Mutex
+}
+
+// Get gets.
+func (s *Store) Get() string { return "" }
+`,
+	})
+	fileOptions := MakeOptions{Files: []string{filepath.Join(dir, "store", "store.go")}, StructType: "Store", PkgName: "gen", IfaceName: "Store", WithPromoted: true, CopyDocs: true}
+	pkgOptions := MakeOptions{Dir: dir, Package: "./store", StructType: "Store", PkgName: "gen", IfaceName: "Store", WithPromoted: true, CopyDocs: true}
+	expected, err := Make(fileOptions)
+	require.NoError(t, err)
+
+	// Targets sharing files and packages are generated concurrently with
+	// one Generator.
+	g := NewGenerator()
+	results := make([][]byte, 8)
+	errs := make([]error, len(results))
+	var wg sync.WaitGroup
+	for i := range results {
+		options := fileOptions
+		if i%2 == 1 {
+			options = pkgOptions
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = g.Make(options)
+		}()
+	}
+	wg.Wait()
+	for i := range results {
+		require.NoError(t, errs[i])
+		require.Equal(t, string(expected), string(results[i]))
+	}
+}
+
+func TestMakeWorkers(t *testing.T) {
+	files := writeBenchPackage(t, t.TempDir(), 40)
+	options := MakeOptions{Files: files, StructType: "S39", Comment: "c", PkgName: "bench", IfaceName: "I", CopyDocs: true, WithPromoted: true, Workers: 1}
+	expected, err := Make(options)
+	require.NoError(t, err)
+	require.Equal(t, 400, strings.Count(string(expected), ") (int, error)\n"))
+
+	for _, workers := range []int{0, 2, 8, 100} {
+		options.Workers = workers
+		result, err := Make(options)
+		require.NoError(t, err)
+		require.Equal(t, string(expected), string(result))
+	}
+
+	// The error of the first broken file is reported.
+	broken := filepath.Join(filepath.Dir(files[0]), "zz_broken.go")
+	require.NoError(t, os.WriteFile(broken, []byte("package bench\n\nfunc {"), 0o644))
+	options.Files = append([]string{files[0], broken}, files[1:]...)
+	options.Files = append(options.Files, filepath.Join(filepath.Dir(files[0]), "missing.go"))
+	_, err = Make(options)
+	var pe *ParseError
+	require.ErrorAs(t, err, &pe)
+	require.Equal(t, broken, pe.File)
+}
+
+func TestMakeSourceDir(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"store/store.go": `package store
+
+type Store struct{}
+
+func (s *Store) Get() string { return "" }
+`,
+		"store/store_linux.go": `package store
+
+func (s *Store) Fd() int { return 0 }
+`,
+		"store/store_windows.go": `package store
+
+func (s *Store) Handle() uintptr { return 0 }
+`,
+		"store/integration.go": `//go:build integration
+
+package store
+
+func (s *Store) Reset() {}
+`,
+		"store/store_test.go": `package store
+
+func (s *Store) Dump() string { return "" }
+`,
+		"store/external_test.go": `package store_test
+
+type Store struct{}
+
+func (s *Store) External() {}
+`,
+	})
+
+	methods := func(options MakeOptions) []string {
+		t.Helper()
+		options.StructType = "Store"
+		options.PkgName = "gen"
+		options.IfaceName = "Store"
+		iface, err := Analyze(options)
+		require.NoError(t, err)
+		var names []string
+		for _, m := range iface.Methods {
+			names = append(names, m.Name)
+		}
+		return names
+	}
+
+	for _, options := range []MakeOptions{
+		{SourceDir: "./store", Dir: dir},
+		{SourceDir: "store", Dir: dir},
+		{SourceDir: filepath.Join(dir, "store")},
+		{SourceDir: "example.com/mod/store", Dir: dir},
+		{Package: "./store", Dir: dir},
+	} {
+		options.Build = BuildConfig{GOOS: "linux", GOARCH: "amd64"}
+		require.ElementsMatch(t, []string{"Fd", "Get"}, methods(options))
+
+		options.Build = BuildConfig{GOOS: "windows", GOARCH: "amd64", Tags: []string{"integration"}, Tests: true}
+		require.ElementsMatch(t, []string{"Get", "Handle", "Reset", "Dump"}, methods(options))
+	}
+
+	_, err := PackageFiles(dir, "./missing", BuildConfig{})
+	require.Error(t, err)
+}
+
+func TestParseTags(t *testing.T) {
+	require.Equal(t, []string{"a", "b", "c"}, ParseTags("a,b c"))
+	require.Empty(t, ParseTags(""))
+}
+
+func TestMakePlatforms(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"store.go":         "package store\n\ntype Store struct{}\n\nfunc (s *Store) Get() string { return \"\" }\n",
+		"store_linux.go":   "package store\n\nfunc (s *Store) Fd() int { return 0 }\n",
+		"store_darwin.go":  "package store\n\nfunc (s *Store) Fd() int { return 0 }\n",
+		"store_windows.go": "package store\n\nfunc (s *Store) Handle() uintptr { return 0 }\n",
+		"integration.go":   "//go:build integration\n\npackage store\n\nfunc (s *Store) Reset() {}\n",
+	}
+	for name, src := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644))
+	}
+	options := MakeOptions{Files: []string{filepath.Join(dir, "*.go")}, StructType: "Store", Comment: "c", PkgName: "gen", IfaceName: "Store"}
+	options.Files, _ = filepath.Glob(options.Files[0])
+
+	// Without a build configuration all files are merged.
+	iface, err := Analyze(options)
+	require.NoError(t, err)
+	require.Len(t, iface.Methods, 4)
+
+	result, err := MakePlatforms(options, []string{"linux/amd64", "windows", "darwin/arm64"})
+	require.NoError(t, err)
+	require.Len(t, result, 2)
+	require.Equal(t, []string{"linux/amd64", "darwin/arm64"}, result[0].Platforms)
+	require.Equal(t, "//go:build (linux && amd64) || (darwin && arm64)", result[0].Constraint)
+	require.Equal(t, `//go:build (linux && amd64) || (darwin && arm64)
+
+// c
+
+package gen
+
+type Store interface {
+	Get() string
+	Fd() int
+}
+`, string(result[0].Code))
+	require.Equal(t, []string{"windows"}, result[1].Platforms)
+	require.Equal(t, "//go:build windows", result[1].Constraint)
+	require.Contains(t, string(result[1].Code), "\tGet() string\n\tHandle() uintptr\n}")
+
+	// Tags apply to every platform.
+	options.Build.Tags = []string{"integration"}
+	result, err = MakePlatforms(options, []string{"linux", "darwin"})
+	require.NoError(t, err)
+	require.Len(t, result, 1)
+	require.Empty(t, result[0].Constraint)
+	require.Equal(t, []string{"linux", "darwin"}, result[0].Platforms)
+	require.Contains(t, string(result[0].Code), "\tReset()\n")
+	require.NotContains(t, string(result[0].Code), "go:build")
+
+	_, err = MakePlatforms(options, []string{"linux/"})
+	require.EqualError(t, err, `invalid platform "linux/", expected GOOS or GOOS/GOARCH`)
+	_, err = MakePlatforms(options, nil)
+	require.Error(t, err)
+
+	require.Equal(t, filepath.Join("gen", "store.linux_amd64-darwin.go"), PlatformFileName(filepath.Join("gen", "store.go"), []string{"linux/amd64", "darwin"}))
+}
+
+func TestMakePromotedFromOtherPackages(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"base/base.go": `package base
+
+type ID int
+
+type Repo struct{}
+
+// Find finds a record.
+func (r *Repo) Find(id ID) (string, error) { return "", nil }
+
+func (r Repo) Name() string { return "" }
+
+func (r *Repo) Get() string { return "" }
+`,
+		"lock/lock.go": `package lock
+
+type Mutex struct{}
+
+// Lock locks m.
+func (m *Mutex) Lock() {}
+
+func (m *Mutex) Unlock() {}
+`,
+		"store/store.go": `package store
+
+import (
+	b "example.com/mod/base"
+	"example.com/mod/lock"
+)
+
+type Store struct {
+	b.Repo
+	inner
+}
+
+type inner struct {
+	*lock.Mutex
+}
+
+func (s *Store) Get() string { return "" }
+`,
+	})
+	options := MakeOptions{Files: []string{filepath.Join(dir, "store", "store.go")}, StructType: "Store", Comment: "c", PkgName: "gen", IfaceName: "Store", CopyDocs: true, WithPromoted: true}
+	result, err := Make(options)
+	require.NoError(t, err)
+	require.Equal(t, `// c
+
+package gen
+
+import (
+	b "example.com/mod/base"
+)
+
+type Store interface {
+	Get() string
+	// Find finds a record.
+	Find(id b.ID) (string, error)
+	Name() string
+	// Lock locks m.
+	Lock()
+	Unlock()
+}
+`, string(result))
+
+	iface, err := Analyze(options)
+	require.NoError(t, err)
+	require.Equal(t, Param{Name: "id", Type: "b.ID", PkgPath: "example.com/mod/base"}, iface.Methods[1].Params[0])
+	require.True(t, iface.Methods[1].PointerReceiver)
+	require.False(t, iface.Methods[2].PointerReceiver)
+	require.False(t, iface.Methods[3].PointerReceiver)
+
+	// Types of the package the interface is generated into aren't qualified,
+	// other packages with its name are.
+	iface, err = Analyze(MakeOptions{Files: options.Files, StructType: "Store", PkgName: "base", PkgPath: "example.com/mod/base", IfaceName: "Store", WithPromoted: true})
+	require.NoError(t, err)
+	require.Equal(t, "Find(id ID) (string, error)", iface.Methods[1].Code)
+	iface, err = Analyze(MakeOptions{Files: options.Files, StructType: "Store", PkgName: "base", IfaceName: "Store", WithPromoted: true})
+	require.NoError(t, err)
+	require.Equal(t, "Find(id b.ID) (string, error)", iface.Methods[1].Code)
+
+	// Without --promoted only the methods of the struct are used.
+	options.WithPromoted = false
+	result, err = Make(options)
+	require.NoError(t, err)
+	require.Contains(t, string(result), "type Store interface {\n\tGet() string\n}\n")
+
+	// The package of the embedded type has to be imported.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "store", "broken.go"), []byte("package store\n\ntype Broken struct{ missing.Type }\n"), 0o644))
+	_, err = Make(MakeOptions{Files: []string{filepath.Join(dir, "store", "broken.go")}, StructType: "Broken", PkgName: "gen", IfaceName: "B", WithPromoted: true})
+	require.ErrorContains(t, err, "can't find the import of embedded type missing.Type")
+}
+
+func TestMakePromotedPackageName(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"go-base/base.go": `package base
+
+type ID int
+
+type Repo struct{}
+
+func (r *Repo) Find(id ID) (string, error) { return "", nil }
+`,
+		"store/store.go": `package store
+
+import "example.com/mod/go-base"
+
+type Store struct {
+	*base.Repo
+}
+
+func (s *Store) Get() string { return "" }
+`,
+	})
+	// The package is found by its name rather than by its import path.
+	options := MakeOptions{Files: []string{filepath.Join(dir, "store", "store.go")}, StructType: "Store", Comment: "c", PkgName: "store", IfaceName: "StoreIface", WithPromoted: true}
+	result, err := Make(options)
+	require.NoError(t, err)
+	require.Equal(t, `// c
+
+package store
+
+import (
+	"example.com/mod/go-base"
+)
+
+type StoreIface interface {
+	Get() string
+	Find(id base.ID) (string, error)
+}
+`, string(result))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "store", "iface.go"), result, 0o644))
+	_, err = LoadPackage(dir, "./store")
+	require.NoError(t, err)
+
+	// Imports that can't be loaded to learn their name only leave the
+	// methods of the type unpromoted.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "store", "other.go"), []byte("package store\n\nimport \"example.com/missing/go-flags\"\n\ntype Other struct{ *flags.Parser }\n"), 0o644))
+	iface, err := Analyze(MakeOptions{Files: []string{filepath.Join(dir, "store", "other.go")}, StructType: "Other", PkgName: "gen", IfaceName: "O", WithPromoted: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{"methods of embedded type flags.Parser are not promoted, its import isn't found: example.com/missing/go-flags can't be loaded"}, iface.Warnings)
+}
+
+func TestMakePromotedSameInBothModes(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"counter/counter.go": `package counter
+
+import "sync"
+
+// Counter counts.
+type Counter struct {
+	sync.RWMutex
+}
+
+// Value returns the count.
+func (c *Counter) Value() int { return 0 }
+
+// Inc increments the count.
+func (c *Counter) Inc() {}
+`,
+		"store/store.go": `package store
+
+import (
+	"sync"
+
+	"example.com/mod/counter"
+)
+
+type Store struct {
+	counter.Counter
+	Base
+	sync.Mutex
+}
+
+// Get gets.
+func (s *Store) Get() string { return "" }
+`,
+		"store/base.go": `package store
+
+type Base struct{}
+
+// Ping pings.
+func (Base) Ping() error { return nil }
+
+// Close closes.
+func (*Base) Close() error { return nil }
+`,
+	})
+	options := MakeOptions{StructType: "Store", PkgName: "gen", IfaceName: "Store", WithPromoted: true, CopyDocs: true}
+	fileOptions := options
+	fileOptions.Files = []string{filepath.Join(dir, "store", "base.go"), filepath.Join(dir, "store", "store.go")}
+	pkgOptions := options
+	pkgOptions.Dir = dir
+	pkgOptions.Package = "./store"
+
+	fromFiles, err := Make(fileOptions)
+	require.NoError(t, err)
+	fromPackage, err := Make(pkgOptions)
+	require.NoError(t, err)
+	require.Equal(t, string(fromFiles), string(fromPackage))
+	require.Contains(t, string(fromPackage), "\t// Value returns the count.\n\tValue() int\n\t// Inc increments the count.\n\tInc()\n\t// RLock locks rw for reading.\n")
+	require.Contains(t, string(fromPackage), "\t// Lock locks m.\n")
+}
+
+func TestMakePromotedUnresolvable(t *testing.T) {
+	// Without a module, and without downloading anything, the embedded
+	// package can't be loaded and the struct's own methods are kept.
+	t.Setenv("GOPROXY", "off")
+	dir := t.TempDir()
+	file := filepath.Join(dir, "store.go")
+	require.NoError(t, os.WriteFile(file, []byte(`package store
+
+import "github.com/acme/unavailable/base"
+
+type Store struct {
+	base.Base
+}
+
+// Get gets a value.
+func (s *Store) Get() string { return "" }
+`), 0o644))
+
+	options := MakeOptions{Files: []string{file}, StructType: "Store", Comment: "c", PkgName: "store", IfaceName: "Store", WithPromoted: true, CopyDocs: true}
+	result, err := Make(options)
+	require.NoError(t, err)
+	require.Equal(t, `// c
+
+package store
+
+type Store interface {
+	// Get gets a value.
+	Get() string
+}
+`, string(result))
+
+	iface, err := Analyze(options)
+	require.NoError(t, err)
+	require.Len(t, iface.Warnings, 1)
+	require.Contains(t, iface.Warnings[0], "methods of embedded type base.Base are not promoted, its package can't be loaded")
+}
+
+func TestMakePromotedInterfaces(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"closer/closer.go": `package closer
+
+type Closer interface {
+	// Close closes it.
+	Close() error
+}
+`,
+		"svc/svc.go": `package svc
+
+import "example.com/mod/closer"
+
+type Svc struct {
+	closer.Closer
+	Logger
+}
+
+type Logger interface {
+	Flusher
+	// Log logs msg.
+	Log(msg string)
+	debug()
+}
+
+type Flusher interface {
+	Flush() error
+}
+
+func (s *Svc) Run() error { return nil }
+
+func (s *Svc) Flush() error { return nil }
+`,
+	})
+	options := MakeOptions{Files: []string{filepath.Join(dir, "svc", "svc.go")}, StructType: "Svc", Comment: "c", PkgName: "gen", IfaceName: "Svc", CopyDocs: true, WithPromoted: true}
+	result, err := Make(options)
+	require.NoError(t, err)
+	require.Equal(t, `// c
+
+package gen
+
+type Svc interface {
+	Run() error
+	Flush() error
+	// Close closes it.
+	Close() error
+	// Log logs msg.
+	Log(msg string)
+}
+`, string(result))
+
+	iface, err := Analyze(options)
+	require.NoError(t, err)
+	// Methods of embedded interfaces are in the method set of the value.
+	require.False(t, iface.Methods[2].PointerReceiver)
+	require.False(t, iface.Methods[3].PointerReceiver)
+
+	options.EmbedInterfaces = true
+	embedded := `// c
+
+package gen
+
+import (
+	"example.com/mod/closer"
+	"example.com/mod/svc"
+)
+
+type Svc interface {
+	closer.Closer
+	svc.Logger
+	Run() error
+	Flush() error
+}
+`
+	iface, err = Analyze(options)
+	require.NoError(t, err)
+	require.Equal(t, []string{"closer.Closer", "svc.Logger"}, iface.Embeds)
+	require.Len(t, iface.Methods, 2)
+	_, err = RenderMock(iface, options)
+	require.ErrorContains(t, err, "a mock needs the methods of the embedded interfaces closer.Closer, svc.Logger")
+
+	// Package mode produces the same interfaces.
+	pkgOptions := options
+	pkgOptions.Files, pkgOptions.Dir, pkgOptions.Package = nil, dir, "./svc"
+	result, err = Make(pkgOptions)
+	require.NoError(t, err)
+	require.Equal(t, embedded, string(result))
+
+	pkgOptions.EmbedInterfaces = false
+	iface, err = Analyze(pkgOptions)
+	require.NoError(t, err)
+	var names []string
+	for _, m := range iface.Methods {
+		names = append(names, m.Name)
+	}
+	require.ElementsMatch(t, []string{"Run", "Flush", "Close", "Log"}, names)
+
+	// Mocks implement the methods of embedded interfaces as well.
+	mock, err := MakeMock(options)
+	require.NoError(t, err)
+	require.Contains(t, string(mock), "func (m *MockSvc) Close() error {")
+}
+
+func TestMakeMethodSets(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"store/store.go": `package store
+
+type A struct{}
+
+func (A) Name() string { return "" }
+
+func (*A) Close() error { return nil }
+
+func (A) Both() int { return 0 }
+
+type B struct{}
+
+func (*B) Reset() {}
+
+type C struct {
+	*B
+	Deep
+}
+
+type D struct{}
+
+func (D) Both() int { return 0 }
+
+type Deep struct{}
+
+func (Deep) Name() string { return "" }
+
+type Store struct {
+	A
+	C
+	D
+}
+
+func (s Store) Get() string { return "" }
+
+func (s *Store) Put() {}
+`,
+	})
+	fileOptions := MakeOptions{Files: []string{filepath.Join(dir, "store", "store.go")}, StructType: "Store", PkgName: "gen", IfaceName: "Store", WithPromoted: true}
+	pkgOptions := MakeOptions{Dir: dir, Package: "./store", StructType: "Store", PkgName: "gen", IfaceName: "Store", WithPromoted: true}
+	for _, options := range []MakeOptions{fileOptions, pkgOptions} {
+		iface, err := Analyze(options)
+		require.NoError(t, err)
+		pointer := make(map[string]bool)
+		for _, m := range iface.Methods {
+			pointer[m.Name] = m.PointerReceiver
+		}
+		// Deep.Name is shadowed by A.Name, A.Both and D.Both are
+		// ambiguous and *B makes Reset part of the value method set.
+		require.Equal(t, map[string]bool{"Get": false, "Put": true, "Name": false, "Close": true, "Reset": false}, pointer)
+		require.Equal(t, []string{"ambiguous selector Store.Both is not promoted, it's found in A and D at the same depth"}, iface.Warnings)
+
+		options.ValueReceiver = true
+		iface, err = Analyze(options)
+		require.NoError(t, err)
+		var names []string
+		for _, m := range iface.Methods {
+			names = append(names, m.Name)
+		}
+		require.ElementsMatch(t, []string{"Get", "Name", "Reset"}, names)
+	}
+
+	iface, err := Analyze(fileOptions)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Get() (string)", "Put()", "Name() (string)", "Close() (error)", "Reset()"}, methodCodes(iface.Methods))
+
+	// A field shadows the methods of deeper embedded types.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "store", "field.go"), []byte("package store\n\ntype Fielded struct {\n\tName string\n\tA\n}\n"), 0o644))
+	iface, err = Analyze(MakeOptions{Files: []string{filepath.Join(dir, "store", "field.go"), fileOptions.Files[0]}, StructType: "Fielded", PkgName: "gen", IfaceName: "F", WithPromoted: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{"Close() (error)", "Both() (int)"}, methodCodes(iface.Methods))
+	require.Empty(t, iface.Warnings)
+}
+
+func methodCodes(methods []Method) []string {
+	var codes []string
+	for _, m := range methods {
+		codes = append(codes, m.Code)
+	}
+	return codes
+}
+
+func TestMakeIncludeExclude(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"repo/repo.go": `package repo
+
+type Repo struct{}
+
+func (r *Repo) GetUser() {}
+func (r *Repo) GetOrder() {}
+func (r *Repo) ListUsers() {}
+func (r *Repo) ListOrders() {}
+func (r *Repo) DeleteUser() {}
+`,
+	})
+	options := MakeOptions{Files: []string{filepath.Join(dir, "repo", "repo.go")}, StructType: "Repo", PkgName: "gen", IfaceName: "Reader"}
+	names := func(options MakeOptions) ([]string, []string) {
+		t.Helper()
+		iface, err := Analyze(options)
+		require.NoError(t, err)
+		var names []string
+		for _, m := range iface.Methods {
+			names = append(names, m.Name)
+		}
+		return names, iface.Warnings
+	}
+
+	options.Include = []string{"Get*", "List*"}
+	got, warnings := names(options)
+	require.Equal(t, []string{"GetUser", "GetOrder", "ListUsers", "ListOrders"}, got)
+	require.Empty(t, warnings)
+
+	options.Include = []string{"/^(Get|Delete)User$/"}
+	options.Exclude = []string{"Delete*", "Put*"}
+	got, warnings = names(options)
+	require.Equal(t, []string{"GetUser"}, got)
+	require.Equal(t, []string{`exclude pattern "Put*" matches no method of Repo`}, warnings)
+
+	// Exclude patterns work alongside exact names and on their own.
+	options = MakeOptions{Files: options.Files, StructType: "Repo", PkgName: "gen", IfaceName: "Reader", ExcludeMethods: []string{"GetUser"}, Exclude: []string{"/Orders?$/"}}
+	got, warnings = names(options)
+	require.Equal(t, []string{"ListUsers", "DeleteUser"}, got)
+	require.Empty(t, warnings)
+
+	options.Include = []string{"Find*"}
+	got, warnings = names(options)
+	require.Empty(t, got)
+	require.Equal(t, []string{`include pattern "Find*" matches no method of Repo`}, warnings)
+
+	options.Include = []string{"/(/"}
+	_, err := Analyze(options)
+	require.ErrorContains(t, err, `invalid pattern "/(/"`)
+	options.Include = []string{"Get["}
+	_, err = Analyze(options)
+	require.ErrorContains(t, err, `invalid pattern "Get["`)
+}
+
+func TestMakeDirectives(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"store/store.go": `package store
+
+type Store struct{}
+
+// Get gets a value.
+//
+//ifacemaker:only=Reader,Store
+func (s *Store) Get(key string) string { return "" }
+
+// Put puts a value.
+//ifacemaker:only=Store
+func (s *Store) Put(key, value string) {}
+
+//ifacemaker:exclude
+func (s *Store) Close() error { return nil }
+
+// Fetch fetches a value.
+//ifacemaker:rename=Load
+func (s *Store) Fetch(key string) (string, error) { return "", nil }
+`,
+	})
+	fileOptions := MakeOptions{Files: []string{filepath.Join(dir, "store", "store.go")}, StructType: "Store", Comment: "c", PkgName: "gen", IfaceName: "Reader", CopyDocs: true}
+	pkgOptions := MakeOptions{Dir: dir, Package: "./store", StructType: "Store", Comment: "c", PkgName: "gen", IfaceName: "Reader", CopyDocs: true}
+	for _, options := range []MakeOptions{fileOptions, pkgOptions} {
+		result, err := Make(options)
+		require.NoError(t, err)
+		require.Equal(t, `// c
+
+package gen
+
+type Reader interface {
+	// Get gets a value.
+	//
+	Get(key string) string
+	// Load fetches a value.
+	Load(key string) (string, error)
+}
+`, string(result))
+
+		options.IfaceName = "Store"
+		iface, err := Analyze(options)
+		require.NoError(t, err)
+		require.Len(t, iface.Methods, 3)
+		require.Equal(t, "Put", iface.Methods[1].Name)
+		require.Equal(t, "Fetch", iface.Methods[2].Original)
+		only, ok := iface.Methods[1].Directive("only")
+		require.True(t, ok)
+		require.Equal(t, "Store", only)
+	}
+
+	// A struct doesn't implement an interface with renamed methods, the
+	// interface itself compiles.
+	options := pkgOptions
+	options.PkgName = "store"
+	options.Assert = true
+	_, err := Make(options)
+	require.ErrorContains(t, err, "Store can't be asserted to implement the interface, its method Fetch is renamed to Load")
+	_, err = MakeAssertion(options, "")
+	require.ErrorContains(t, err, "its method Fetch is renamed to Load")
+	options.Assert = false
+	result, err := Make(options)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "store", "reader.go"), result, 0o644))
+	_, err = LoadPackage(dir, "./store")
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(filepath.Join(dir, "store", "reader.go")))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "store", "bad.go"), []byte("package store\n\ntype Bad struct{}\n\n//ifacemaker:rename=Get\nfunc (b Bad) Fetch() {}\n\nfunc (b Bad) Get() {}\n"), 0o644))
+	_, err = Analyze(MakeOptions{Files: []string{filepath.Join(dir, "store", "bad.go")}, StructType: "Bad", PkgName: "gen", IfaceName: "Bad"})
+	require.ErrorContains(t, err, "method Get: duplicate method name in Bad")
+}
+
+func TestMakeRoles(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"user/user.go": `package user
+
+type UserStore struct{}
+
+// Get gets a user.
+func (s *UserStore) Get(id int) string { return "" }
+
+func (s *UserStore) List() []string { return nil }
+
+func (s *UserStore) Create(name string) int { return 0 }
+
+func (s *UserStore) Delete(id int) {}
+
+//ifacemaker:only=UserReader
+func (s *UserStore) Count() int { return 0 }
+
+func (s *UserStore) Migrate() {}
+`,
+	})
+	options := MakeOptions{
+		Files:      []string{filepath.Join(dir, "user", "user.go")},
+		StructType: "UserStore",
+		Comment:    "c",
+		PkgName:    "user",
+		IfaceName:  "Store",
+		CopyDocs:   true,
+		Assert:     true,
+		Roles: []RoleOptions{
+			{Name: "UserReader", Comment: "UserReader reads users.", Include: []string{"Get*", "List*"}},
+			{Name: "UserWriter", Include: []string{"*"}, Exclude: []string{"Get*", "List*", "Migrate"}},
+			{Name: "UserAdmin"},
+		},
+	}
+	result, err := Make(options)
+	require.NoError(t, err)
+	require.Equal(t, `// c
+
+package user
+
+// UserReader reads users.
+type UserReader interface {
+	// Get gets a user.
+	Get(id int) string
+	List() []string
+	Count() int
+}
+
+type UserWriter interface {
+	Create(name string) int
+	Delete(id int)
+}
+
+type UserAdmin interface {
+}
+
+type Store interface {
+	UserReader
+	UserWriter
+	UserAdmin
+}
+
+var _ Store = (*UserStore)(nil)
+`, string(result))
+
+	iface, err := Analyze(options)
+	require.NoError(t, err)
+	require.Len(t, iface.Methods, 5)
+	require.Equal(t, []string{"role UserAdmin has no methods", "method Migrate of UserStore is in no role"}, iface.Warnings)
+
+	// Without a composite interface every role is asserted.
+	options.IfaceName = ""
+	options.Roles = options.Roles[:2]
+	result, err = Make(options)
+	require.NoError(t, err)
+	require.NotContains(t, string(result), "type Store interface")
+	require.Contains(t, string(result), "var _ UserReader = (*UserStore)(nil)\nvar _ UserWriter = (*UserStore)(nil)\n")
+
+	_, err = MakeMock(options)
+	require.ErrorContains(t, err, "composite interface")
+}
+
+func TestParseRole(t *testing.T) {
+	role, err := ParseRole("UserWriter=*,!Get*,!/^List/")
+	require.NoError(t, err)
+	require.Equal(t, RoleOptions{Name: "UserWriter", Include: []string{"*"}, Exclude: []string{"Get*", "/^List/"}}, role)
+
+	role, err = ParseRole("UserAdmin")
+	require.NoError(t, err)
+	require.Equal(t, RoleOptions{Name: "UserAdmin"}, role)
+
+	_, err = ParseRole("=Get*")
+	require.ErrorContains(t, err, `invalid role "=Get*"`)
+}
+
+func TestMakeWrapper(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"store/store.go": `package store
+
+import (
+	"context"
+	"io"
+)
+
+type Store[T any] struct{}
+
+func (s *Store[T]) Get(ctx context.Context, id string) (item T, err error) { return item, nil }
+func (s *Store[T]) Close() {}
+func (s *Store[T]) Dump(io.Writer, string, ...string) int { return 0 }
+func (s *Store[T]) Put(_ context.Context, w T, _ int) error { return nil }
+`,
+	})
+	options := MakeOptions{
+		Files:      []string{filepath.Join(dir, "store", "store.go")},
+		StructType: "Store",
+		Comment:    "Test Comment",
+		PkgName:    "store",
+		IfaceName:  "StoreIface",
+	}
+	result, err := MakeWrapper(options)
+	require.NoError(t, err)
+	require.Equal(t, `// Test Comment
+
+package store
+
+import (
+	"context"
+	"io"
+)
+
+// StoreIfaceWrapper implements StoreIface by forwarding every call to Next.
+// Embed it into a decorator to only override some of the methods.
+type StoreIfaceWrapper[T any] struct {
+	Next StoreIface[T]
+}
+
+func _[T any]() {
+	var _ StoreIface[T] = StoreIfaceWrapper[T]{}
+}
+
+// Get calls Next.Get.
+func (w StoreIfaceWrapper[T]) Get(ctx context.Context, id string) (T, error) {
+	return w.Next.Get(ctx, id)
+}
+
+// Close calls Next.Close.
+func (w StoreIfaceWrapper[T]) Close() {
+	w.Next.Close()
+}
+
+// Dump calls Next.Dump.
+func (w StoreIfaceWrapper[T]) Dump(arg0 io.Writer, arg1 string, arg2 ...string) int {
+	return w.Next.Dump(arg0, arg1, arg2...)
+}
+
+// Put calls Next.Put.
+func (w_ StoreIfaceWrapper[T]) Put(arg0 context.Context, w T, arg2 int) error {
+	return w_.Next.Put(arg0, w, arg2)
+}
+`, string(result))
+
+	// The interface and its wrapper compile together.
+	iface, err := Make(options)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "store", "iface.go"), iface, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "store", "wrapper.go"), result, 0o644))
+	_, err = LoadPackage(dir, "./store")
+	require.NoError(t, err)
+}
+
+func TestMakeDecoratorsFieldClash(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"iter/iter.go": `package iter
+
+import "time"
+
+type Iter struct{}
+
+func (i *Iter) Next() bool { return false }
+func (i *Iter) Next_() error { return nil }
+func (i *Iter) Logger() string { return "" }
+func (i *Iter) Tracer() string { return "" }
+func (i *Iter) Metrics() string { return "" }
+func (i *Iter) Attempts() int { return 0 }
+func (i *Iter) Backoff() time.Duration { return 0 }
+func (i *Iter) Retryable(err error) bool { return false }
+func (i *Iter) Breaker() error { return nil }
+`,
+	})
+	options := MakeOptions{
+		Files:      []string{filepath.Join(dir, "iter", "iter.go")},
+		StructType: "Iter",
+		Comment:    "Test Comment",
+		PkgName:    "iter",
+		IfaceName:  "Iterator",
+	}
+	iface, err := Make(options)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "iter", "iface.go"), iface, 0o644))
+
+	// The fields of the decorators are renamed not to clash with the
+	// methods, and the decorators compile.
+	wrapper, err := MakeWrapper(options)
+	require.NoError(t, err)
+	require.Contains(t, string(wrapper), "type IteratorWrapper struct {\n\tNext__ Iterator\n}")
+	require.Contains(t, string(wrapper), "return w.Next__.Next()")
+	logging, err := MakeLogging(options)
+	require.NoError(t, err)
+	require.Contains(t, string(logging), "return LoggingIterator{Next__: next, Logger_: logger}")
+	retry, err := MakeRetry(options)
+	require.NoError(t, err)
+	require.Contains(t, string(retry), "if attempt >= r.Attempts_ || (r.Retryable_ != nil && !r.Retryable_(err)) {")
+	for name, code := range map[string][]byte{"wrapper.go": wrapper, "logging.go": logging, "retry.go": retry} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "iter", name), code, 0o644))
+	}
+	_, err = LoadPackage(dir, "./iter")
+	require.NoError(t, err)
+
+	traced, err := MakeTraced(options)
+	require.NoError(t, err)
+	require.Contains(t, string(traced), "return TracedIterator{Next__: next, Tracer_: tracer}")
+	metrics, err := MakeMetrics(options)
+	require.NoError(t, err)
+	require.Contains(t, string(metrics), "type MetricsIterator struct {\n\tNext__   Iterator\n\tMetrics_ *IteratorMetrics\n}")
+}
+
+func TestMakeTraced(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"store/store.go": `package store
+
+import (
+	"context"
+	"io"
+)
+
+type Store[T any] struct{}
+
+func (s *Store[T]) Get(ctx context.Context, id string) (item T, err error) { return item, nil }
+func (s *Store[T]) Close() {}
+func (s *Store[T]) Dump(w io.Writer, trace string) int { return 0 }
+func (s *Store[T]) Put(_ context.Context, item T) error { return nil }
+`,
+	})
+	result, err := MakeTraced(MakeOptions{
+		Files:      []string{filepath.Join(dir, "store", "store.go")},
+		StructType: "Store",
+		Comment:    "Test Comment",
+		PkgName:    "store",
+		IfaceName:  "StoreIface",
+	})
+	require.NoError(t, err)
+	require.Equal(t, `// Test Comment
+
+package store
+
+import (
+	"context"
+	"io"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracedStoreIface implements StoreIface by recording a span around every call to Next.
+type TracedStoreIface[T any] struct {
+	Next   StoreIface[T]
+	Tracer trace.Tracer
+}
+
+func _[T any]() {
+	var _ StoreIface[T] = TracedStoreIface[T]{}
+}
+
+// NewTracedStoreIface returns a TracedStoreIface recording the calls to next with tracer.
+func NewTracedStoreIface[T any](next StoreIface[T], tracer trace.Tracer) TracedStoreIface[T] {
+	return TracedStoreIface[T]{Next: next, Tracer: tracer}
+}
+
+// Get calls Next.Get within a span.
+func (t TracedStoreIface[T]) Get(ctx context.Context, id string) (T, error) {
+	ctx, span := t.Tracer.Start(ctx, "StoreIface.Get")
+	defer span.End()
+	r0, err := t.Next.Get(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return r0, err
+}
+
+// Close calls Next.Close within a span.
+func (t TracedStoreIface[T]) Close() {
+	_, span := t.Tracer.Start(context.Background(), "StoreIface.Close")
+	defer span.End()
+	t.Next.Close()
+}
+
+// Dump calls Next.Dump within a span.
+func (t TracedStoreIface[T]) Dump(w io.Writer, arg1 string) int {
+	_, span := t.Tracer.Start(context.Background(), "StoreIface.Dump")
+	defer span.End()
+	return t.Next.Dump(w, arg1)
+}
+
+// Put calls Next.Put within a span.
+func (t TracedStoreIface[T]) Put(arg0 context.Context, item T) error {
+	arg0, span := t.Tracer.Start(arg0, "StoreIface.Put")
+	defer span.End()
+	err := t.Next.Put(arg0, item)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+`, string(result))
+}
+
+// runTestModule runs the tests of the module in dir, whose go.mod lists
+// its requirements, with a separate go command. The test is skipped when
+// they can't be downloaded.
+func runTestModule(t *testing.T, dir string) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping a separate go test run in short mode")
+	}
+	tidy := exec.Command("go", "mod", "tidy")
+	tidy.Dir = dir
+	if out, err := tidy.CombinedOutput(); err != nil {
+		t.Skipf("requirements of the test module unavailable: %v\n%s", err, out)
+	}
+	test := exec.Command("go", "test", "./...")
+	test.Dir = dir
+	out, err := test.CombinedOutput()
+	require.NoError(t, err, string(out))
+}
+
+func TestMakeTracedRun(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"store/store.go": `package store
+
+import (
+	"context"
+	"errors"
+)
+
+type Store struct{}
+
+func (s *Store) Get(ctx context.Context, id string) (string, error) {
+	if id == "" {
+		return "", errors.New("empty id")
+	}
+	return "value " + id, nil
+}
+
+func (s *Store) Len() int { return 1 }
+`,
+		"gen/traced_test.go": `package gen
+
+import (
+	"context"
+	"testing"
+
+	"example.com/mod/store"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracedStore(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer("test")
+	traced := NewTracedStore(&store.Store{}, tracer)
+
+	ctx, parent := tracer.Start(context.Background(), "parent")
+	if v, err := traced.Get(ctx, "1"); v != "value 1" || err != nil {
+		t.Fatalf("Get returned %q, %v", v, err)
+	}
+	if _, err := traced.Get(ctx, ""); err == nil || err.Error() != "empty id" {
+		t.Fatalf("Get returned %v", err)
+	}
+	parent.End()
+	if traced.Len() != 1 {
+		t.Fatal("Len isn't forwarded")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 4 {
+		t.Fatalf("got %d spans", len(spans))
+	}
+	for i, name := range []string{"Store.Get", "Store.Get", "parent", "Store.Len"} {
+		if spans[i].Name != name {
+			t.Errorf("span %d is named %s, not %s", i, spans[i].Name, name)
+		}
+	}
+	for _, s := range spans[:2] {
+		if s.Parent.SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("span %s isn't a child of the span of the context", s.Name)
+		}
+	}
+	if spans[3].Parent.IsValid() {
+		t.Error("span Store.Len without a context has a parent")
+	}
+	if s := spans[0]; s.Status.Code != codes.Unset || len(s.Events) != 0 {
+		t.Errorf("successful call recorded %v with %d events", s.Status, len(s.Events))
+	}
+	if s := spans[1]; s.Status.Code != codes.Error || s.Status.Description != "empty id" || len(s.Events) != 1 || s.Events[0].Name != "exception" {
+		t.Errorf("failed call recorded %v with events %v", s.Status, s.Events)
+	}
+}
+`,
+	})
+	// The requirements of the generated code and of the test.
+	goMod := "module example.com/mod\n\ngo 1.23.0\n\nrequire (\n" +
+		"\tgo.opentelemetry.io/otel v1.38.0\n" +
+		"\tgo.opentelemetry.io/otel/sdk v1.38.0\n" +
+		"\tgo.opentelemetry.io/otel/trace v1.38.0\n)\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0o644))
+
+	options := MakeOptions{
+		Files:      []string{filepath.Join(dir, "store", "store.go")},
+		StructType: "Store",
+		PkgName:    "gen",
+		IfaceName:  "Store",
+	}
+	iface, err := Make(options)
+	require.NoError(t, err)
+	traced, err := MakeTraced(options)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "gen", "store.go"), iface, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "gen", "traced.go"), traced, 0o644))
+
+	runTestModule(t, dir)
+}
+
+func TestMakeMetrics(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"store/store.go": `package store
+
+import "time"
+
+type UserStore struct{}
+
+func (s *UserStore) Get(id string) (string, error) { return "", nil }
+func (s *UserStore) Close() {}
+func (s *UserStore) Touch(start time.Time) bool { return false }
+`,
+	})
+	options := MakeOptions{
+		Files:      []string{filepath.Join(dir, "store", "store.go")},
+		StructType: "UserStore",
+		Comment:    "Test Comment",
+		PkgName:    "store",
+		IfaceName:  "UserStore",
+	}
+	result, err := MakeMetrics(options)
+	require.NoError(t, err)
+	require.Equal(t, `// Test Comment
+
+package store
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricsUserStore implements UserStore by recording metrics of every call to Next.
+type MetricsUserStore struct {
+	Next    UserStore
+	Metrics *UserStoreMetrics
+}
+
+var _ UserStore = MetricsUserStore{}
+
+// UserStoreMetrics are the metrics recorded by MetricsUserStore.
+type UserStoreMetrics struct {
+	Calls    *prometheus.CounterVec
+	Errors   *prometheus.CounterVec
+	Duration *prometheus.HistogramVec
+}
+
+// NewUserStoreMetrics creates the metrics of MetricsUserStore and registers them with reg.
+func NewUserStoreMetrics(reg prometheus.Registerer) (*UserStoreMetrics, error) {
+	m := &UserStoreMetrics{
+		Calls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "user_store_calls_total",
+			Help: "Number of method calls of UserStore.",
+		}, []string{"method"}),
+		Errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "user_store_errors_total",
+			Help: "Number of method calls of UserStore returning an error.",
+		}, []string{"method"}),
+		Duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "user_store_duration_seconds",
+			Help:    "Duration of the method calls of UserStore in seconds.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method"}),
+	}
+	for _, c := range []prometheus.Collector{m.Calls, m.Errors, m.Duration} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Get calls Next.Get and records it.
+func (m MetricsUserStore) Get(id string) (string, error) {
+	start := time.Now()
+	r0, err := m.Next.Get(id)
+	m.Metrics.Duration.WithLabelValues("Get").Observe(time.Since(start).Seconds())
+	m.Metrics.Calls.WithLabelValues("Get").Inc()
+	if err != nil {
+		m.Metrics.Errors.WithLabelValues("Get").Inc()
+	}
+	return r0, err
+}
+
+// Close calls Next.Close and records it.
+func (m MetricsUserStore) Close() {
+	start := time.Now()
+	m.Next.Close()
+	m.Metrics.Duration.WithLabelValues("Close").Observe(time.Since(start).Seconds())
+	m.Metrics.Calls.WithLabelValues("Close").Inc()
+}
+
+// Touch calls Next.Touch and records it.
+func (m MetricsUserStore) Touch(start time.Time) bool {
+	start_ := time.Now()
+	r0 := m.Next.Touch(start)
+	m.Metrics.Duration.WithLabelValues("Touch").Observe(time.Since(start_).Seconds())
+	m.Metrics.Calls.WithLabelValues("Touch").Inc()
+	return r0
+}
+`, string(result))
+
+	options.Metrics = MetricsOptions{Calls: "repo_calls_total", MethodLabel: "op", IfaceLabel: "repo"}
+	result, err = MakeMetrics(options)
+	require.NoError(t, err)
+	require.Contains(t, string(result), `Name:        "repo_calls_total",
+			Help:        "Number of method calls.",
+			ConstLabels: prometheus.Labels{"repo": "UserStore"},
+		}, []string{"op"}),`)
+	require.Contains(t, string(result), `Name:        "user_store_errors_total",`)
+
+	require.Equal(t, "http_client", snakeCase("HTTPClient"))
+	require.Equal(t, "user_store2", snakeCase("UserStore2"))
+
+}
+
+func TestMakeLogging(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"auth/auth.go": `package auth
+
+import "context"
+
+type Auth struct{}
+
+func (a *Auth) Login(ctx context.Context, user, Password string) (token string, err error) { return "", nil }
+
+//ifacemaker:nolog
+func (a *Auth) Ping() bool { return true }
+
+func (a *Auth) Revoke(apiToken string, all ...bool) {}
+`,
+	})
+	options := MakeOptions{
+		Files:      []string{filepath.Join(dir, "auth", "auth.go")},
+		StructType: "Auth",
+		Comment:    "Test Comment",
+		PkgName:    "auth",
+		IfaceName:  "Authenticator",
+	}
+	result, err := MakeLogging(options)
+	require.NoError(t, err)
+	require.Equal(t, `// Test Comment
+
+package auth
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LoggingAuthenticator implements Authenticator by logging every call to Next with Logger.
+type LoggingAuthenticator struct {
+	Next   Authenticator
+	Logger *slog.Logger
+}
+
+var _ Authenticator = LoggingAuthenticator{}
+
+// NewLoggingAuthenticator returns a LoggingAuthenticator logging the calls to next with logger.
+func NewLoggingAuthenticator(next Authenticator, logger *slog.Logger) LoggingAuthenticator {
+	return LoggingAuthenticator{Next: next, Logger: logger}
+}
+
+// Login calls Next.Login and logs it.
+func (l LoggingAuthenticator) Login(ctx context.Context, user string, Password string) (string, error) {
+	l.Logger.LogAttrs(ctx, slog.LevelDebug, "calling Authenticator.Login", slog.Any("user", user), slog.String("Password", "[REDACTED]"))
+	r0, err := l.Next.Login(ctx, user, Password)
+	if err != nil {
+		l.Logger.LogAttrs(ctx, slog.LevelError, "Authenticator.Login failed", slog.Any("error", err))
+	} else {
+		l.Logger.LogAttrs(ctx, slog.LevelDebug, "Authenticator.Login returned")
+	}
+	return r0, err
+}
+
+// Ping calls Next.Ping.
+func (l LoggingAuthenticator) Ping() bool {
+	return l.Next.Ping()
+}
+
+// Revoke calls Next.Revoke and logs it.
+func (l LoggingAuthenticator) Revoke(apiToken string, all ...bool) {
+	l.Logger.LogAttrs(context.Background(), slog.LevelDebug, "calling Authenticator.Revoke", slog.String("apiToken", "[REDACTED]"), slog.Any("all", all))
+	l.Next.Revoke(apiToken, all...)
+	l.Logger.LogAttrs(context.Background(), slog.LevelDebug, "Authenticator.Revoke returned")
+}
+`, string(result))
+
+	// The interface and its decorator compile together.
+	iface, err := Make(options)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "auth", "iface.go"), iface, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "auth", "logging.go"), result, 0o644))
+	_, err = LoadPackage(dir, "./auth")
+	require.NoError(t, err)
+
+	options.Redact = []string{"/^us/"}
+	result, err = MakeLogging(options)
+	require.NoError(t, err)
+	require.Contains(t, string(result), `slog.String("user", "[REDACTED]"), slog.Any("Password", Password))`)
+	require.Contains(t, string(result), `slog.Any("apiToken", apiToken)`)
+
+	options.NoRedact = true
+	result, err = MakeLogging(options)
+	require.NoError(t, err)
+	require.NotContains(t, string(result), redactedValue)
+}
+
+func TestMakeRetry(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"client/client.go": `package client
+
+import "context"
+
+type Client[T any] struct{}
+
+func (c *Client[T]) Fetch(ctx context.Context, id string) (T, int, error) { var z T; return z, 0, nil }
+func (c *Client[T]) Send(attempt int, items ...T) error { return nil }
+func (c *Client[T]) Name() string { return "" }
+`,
+	})
+	options := MakeOptions{
+		Files:      []string{filepath.Join(dir, "client", "client.go")},
+		StructType: "Client",
+		Comment:    "Test Comment",
+		PkgName:    "client",
+		IfaceName:  "API",
+	}
+	result, err := MakeRetry(options)
+	require.NoError(t, err)
+	require.Equal(t, `// Test Comment
+
+package client
+
+import (
+	"context"
+	"time"
+)
+
+// RetryAPI implements API by calling the methods of Next returning an error
+// again while they fail, according to its policy.
+type RetryAPI[T any] struct {
+	Next API[T]
+	// Attempts is the maximum number of calls of a method, one if it
+	// is not positive.
+	Attempts int
+	// Backoff returns the delay before the attempt following attempt,
+	// starting at 1. Attempts follow each other immediately if it is nil.
+	Backoff func(attempt int) time.Duration
+	// Retryable reports whether a call that failed with err is attempted
+	// again. Every error is if it is nil.
+	Retryable func(err error) bool
+	// Breaker, if not nil, is a circuit breaker guarding every attempt.
+	Breaker RetryAPIBreaker
+}
+
+func _[T any]() {
+	var _ API[T] = RetryAPI[T]{}
+}
+
+// RetryAPIBreaker is a circuit breaker guarding the calls of RetryAPI.
+type RetryAPIBreaker interface {
+	// Allow returns an error, returned to the caller without calling
+	// Next, when calls are not allowed at the moment.
+	Allow() error
+	// Done records the error, or nil, returned by an allowed call.
+	Done(err error)
+}
+
+// call calls fn, guarded by the circuit breaker.
+func (r RetryAPI[T]) call(fn func() error) error {
+	if r.Breaker != nil {
+		if err := r.Breaker.Allow(); err != nil {
+			return err
+		}
+	}
+	err := fn()
+	if r.Breaker != nil {
+		r.Breaker.Done(err)
+	}
+	return err
+}
+
+// retry waits for the backoff before the attempt following attempt, which
+// failed with err. It returns nil to make that attempt, or the error to
+// return: err if it isn't retried, or the error of ctx once it's done.
+func (r RetryAPI[T]) retry(ctx context.Context, attempt int, err error) error {
+	if attempt >= r.Attempts || (r.Retryable != nil && !r.Retryable(err)) {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var delay time.Duration
+	if r.Backoff != nil {
+		delay = r.Backoff(attempt)
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+	return ctx.Err()
+}
+
+// Fetch calls Next.Fetch until it succeeds or isn't retried.
+func (r RetryAPI[T]) Fetch(ctx context.Context, id string) (T, int, error) {
+	var r0 T
+	var r1 int
+	for attempt := 1; ; attempt++ {
+		err := r.call(func() (err error) {
+			r0, r1, err = r.Next.Fetch(ctx, id)
+			return err
+		})
+		if err == nil {
+			return r0, r1, err
+		}
+		if err = r.retry(ctx, attempt, err); err != nil {
+			return r0, r1, err
+		}
+	}
+}
+
+// Send calls Next.Send until it succeeds or isn't retried.
+func (r RetryAPI[T]) Send(attempt int, items ...T) error {
+	for attempt_ := 1; ; attempt_++ {
+		err := r.call(func() error {
+			return r.Next.Send(attempt, items...)
+		})
+		if err == nil {
+			return err
+		}
+		if err = r.retry(context.Background(), attempt_, err); err != nil {
+			return err
+		}
+	}
+}
+
+// Name calls Next.Name.
+func (r RetryAPI[T]) Name() string {
+	return r.Next.Name()
+}
+`, string(result))
+
+	// The interface and its decorator compile together.
+	iface, err := Make(options)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "client", "iface.go"), iface, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "client", "retry.go"), result, 0o644))
+	_, err = LoadPackage(dir, "./client")
+	require.NoError(t, err)
+}
+
+func TestMakeRetryRun(t *testing.T) {
+	dir := writeTestModule(t, map[string]string{
+		"client/client.go": `package client
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrUnavailable = errors.New("unavailable")
+
+type Client struct {
+	calls    int
+	failures int
+	onCall   func()
+}
+
+func (c *Client) Fetch(ctx context.Context, id string) (string, error) {
+	c.calls++
+	if c.onCall != nil {
+		c.onCall()
+	}
+	if c.calls <= c.failures {
+		return "", ErrUnavailable
+	}
+	return "value " + id, nil
+}
+`,
+		"client/retry_test.go": `package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	c := &Client{failures: 2}
+	v, err := RetryAPI{Next: c, Attempts: 3}.Fetch(context.Background(), "1")
+	if v != "value 1" || err != nil || c.calls != 3 {
+		t.Fatalf("got %q, %v after %d calls", v, err, c.calls)
+	}
+
+	c = &Client{failures: 2}
+	_, err = RetryAPI{Next: c, Attempts: 2}.Fetch(context.Background(), "1")
+	if err != ErrUnavailable || c.calls != 2 {
+		t.Fatalf("got %v after %d calls", err, c.calls)
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	// Without a backoff, the cancellation is noticed before the next
+	// attempt every time.
+	for i := 0; i < 100; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		c := &Client{failures: 5, onCall: cancel}
+		_, err := RetryAPI{Next: c, Attempts: 5}.Fetch(ctx, "1")
+		if !errors.Is(err, context.Canceled) || c.calls != 1 {
+			t.Fatalf("got %v after %d calls", err, c.calls)
+		}
+	}
+
+	// The deadline passes during the backoff.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	c := &Client{failures: 5}
+	backoff := func(int) time.Duration { return time.Hour }
+	_, err := RetryAPI{Next: c, Attempts: 5, Backoff: backoff}.Fetch(ctx, "1")
+	if !errors.Is(err, context.DeadlineExceeded) || c.calls != 1 {
+		t.Fatalf("got %v after %d calls", err, c.calls)
+	}
+}
+`,
+	})
+	options := MakeOptions{
+		Files:      []string{filepath.Join(dir, "client", "client.go")},
+		StructType: "Client",
+		PkgName:    "client",
+		IfaceName:  "API",
+	}
+	iface, err := Make(options)
+	require.NoError(t, err)
+	retry, err := MakeRetry(options)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "client", "iface.go"), iface, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "client", "retry.go"), retry, 0o644))
+
+	runTestModule(t, dir)
+}
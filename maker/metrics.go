@@ -0,0 +1,174 @@
+package maker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// prometheusImport is the import path of the Prometheus client used by the
+// generated metrics decorators.
+const prometheusImport = "github.com/prometheus/client_golang/prometheus"
+
+// MetricsOptions names the metrics recorded by the decorators generated
+// by MakeMetrics. Empty names are derived from the name of the interface,
+// e.g. user_store_calls_total for UserStore.
+type MetricsOptions struct {
+	// Calls is the name of the counter of calls.
+	Calls string
+	// Errors is the name of the counter of calls returning a non-nil
+	// error as their last result.
+	Errors string
+	// Duration is the name of the histogram of the durations of the
+	// calls, in seconds.
+	Duration string
+	// MethodLabel is the name of the label holding the name of the
+	// method, "method" if it is empty.
+	MethodLabel string
+	// IfaceLabel, when set, is the name of a constant label holding the
+	// name of the interface, so that the decorators of several interfaces
+	// can share the same metrics.
+	IfaceLabel string
+}
+
+// withDefaults returns o with the empty names set to the ones derived from
+// ifaceName.
+func (o MetricsOptions) withDefaults(ifaceName string) MetricsOptions {
+	prefix := snakeCase(ifaceName)
+	if o.Calls == "" {
+		o.Calls = prefix + "_calls_total"
+	}
+	if o.Errors == "" {
+		o.Errors = prefix + "_errors_total"
+	}
+	if o.Duration == "" {
+		o.Duration = prefix + "_duration_seconds"
+	}
+	if o.MethodLabel == "" {
+		o.MethodLabel = "method"
+	}
+	return o
+}
+
+// snakeCase turns a Go identifier into snake case, e.g. "HTTPClient" into
+// "http_client".
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// MakeMetrics generates a decorator of the interface described by options
+// recording the number of calls, of errors and the latency of every method
+// with Prometheus metrics named by options.Metrics. The decorator is named
+// after the interface, e.g. MetricsStore, belongs to the same package and
+// is meant to be written to a separate file next to it.
+func MakeMetrics(options MakeOptions) ([]byte, error) {
+	return NewGenerator().MakeMetrics(options)
+}
+
+// MakeMetrics generates a metrics decorator of the interface described by
+// options, see MakeMetrics.
+func (g *Generator) MakeMetrics(options MakeOptions) ([]byte, error) {
+	data, err := g.cache.collectImplemented(options)
+	if err != nil {
+		return nil, err
+	}
+	return RenderMetrics(data, options)
+}
+
+// RenderMetrics renders the metrics decorator of iface with the metrics
+// named by options.Metrics, see MakeMetrics.
+func RenderMetrics(iface *Interface, options MakeOptions) ([]byte, error) {
+	if err := checkImplemented(iface, "metrics decorator"); err != nil {
+		return nil, err
+	}
+	return MakeMetricsCode(iface, options.Metrics)
+}
+
+// MakeMetricsCode generates the struct MetricsIfaceName implementing iface
+// by calling the same methods of its field Next, and IfaceNameMetrics, the
+// metrics it records. Every call is counted and its duration observed,
+// and calls returning a non-nil error as their last result are counted as
+// errors, all labeled with the name of the method.
+func MakeMetricsCode(iface *Interface, options MetricsOptions) ([]byte, error) {
+	targs, err := typeParamNames(iface.TypeParams)
+	if err != nil {
+		return nil, err
+	}
+	options = options.withDefaults(iface.IfaceName)
+	decorator := "Metrics" + iface.IfaceName
+	metrics := iface.IfaceName + "Metrics"
+	next, metricsField := memberName(iface, "Next"), memberName(iface, "Metrics")
+
+	imports := &decoratorImports{iface: iface}
+	timePkg := imports.use("time")
+	promPkg := imports.use(prometheusImport)
+
+	var b strings.Builder
+	writeHeader(&b, iface, imports.specs)
+	fmt.Fprintf(&b, "// %s implements %s by recording metrics of every call to %s.\n", decorator, iface.IfaceName, next)
+	fmt.Fprintf(&b, "type %s%s struct {\n%s %s%s\n%s *%s\n}\n", decorator, iface.TypeParams, next, iface.IfaceName, targs, metricsField, metrics)
+	writeImplements(&b, iface, decorator+targs+"{}")
+
+	fmt.Fprintf(&b, "\n// %s are the metrics recorded by %s.\n", metrics, decorator)
+	fmt.Fprintf(&b, "type %s struct {\nCalls *%s.CounterVec\nErrors *%s.CounterVec\nDuration *%s.HistogramVec\n}\n", metrics, promPkg, promPkg, promPkg)
+
+	// Metrics shared by several interfaces are only told apart by their
+	// labels, their help needs to be the same.
+	of := " of " + iface.IfaceName
+	constLabels := ""
+	if options.IfaceLabel != "" {
+		of = ""
+		constLabels = fmt.Sprintf("ConstLabels: %s.Labels{%s: %s},\n", promPkg, strconv.Quote(options.IfaceLabel), strconv.Quote(iface.IfaceName))
+	}
+	labels := fmt.Sprintf("[]string{%s}", strconv.Quote(options.MethodLabel))
+	fmt.Fprintf(&b, "\n// New%s creates the metrics of %s and registers them with reg.\n", metrics, decorator)
+	fmt.Fprintf(&b, "func New%s(reg %s.Registerer) (*%s, error) {\nm := &%s{\n", metrics, promPkg, metrics, metrics)
+	fmt.Fprintf(&b, "Calls: %s.NewCounterVec(%s.CounterOpts{\nName: %s,\nHelp: %s,\n%s}, %s),\n", promPkg, promPkg,
+		strconv.Quote(options.Calls), strconv.Quote("Number of method calls"+of+"."), constLabels, labels)
+	fmt.Fprintf(&b, "Errors: %s.NewCounterVec(%s.CounterOpts{\nName: %s,\nHelp: %s,\n%s}, %s),\n", promPkg, promPkg,
+		strconv.Quote(options.Errors), strconv.Quote("Number of method calls"+of+" returning an error."), constLabels, labels)
+	fmt.Fprintf(&b, "Duration: %s.NewHistogramVec(%s.HistogramOpts{\nName: %s,\nHelp: %s,\n%sBuckets: %s.DefBuckets,\n}, %s),\n}\n", promPkg, promPkg,
+		strconv.Quote(options.Duration), strconv.Quote("Duration of the method calls"+of+" in seconds."), constLabels, promPkg, labels)
+	fmt.Fprintf(&b, "for _, c := range []%s.Collector{m.Calls, m.Errors, m.Duration} {\n", promPkg)
+	b.WriteString("if err := reg.Register(c); err != nil {\nreturn nil, err\n}\n}\nreturn m, nil\n}\n")
+
+	for _, m := range iface.Methods {
+		d := newDecoratedMethod(m, imports.names)
+		recv := d.declare("m")
+		method := strconv.Quote(m.Name)
+		fmt.Fprintf(&b, "\n// %s calls %s.%s and records it.\n", m.Name, next, m.Name)
+		b.WriteString(d.signature(recv, decorator+targs))
+
+		start := d.declare("start")
+		vars := d.resultVars()
+		fmt.Fprintf(&b, "%s := %s.Now()\n", start, timePkg)
+		call := d.call(recv + "." + next)
+		if len(vars) > 0 {
+			call = strings.Join(vars, ", ") + " := " + call
+		}
+		b.WriteString(call + "\n")
+		fmt.Fprintf(&b, "%s.%s.Duration.WithLabelValues(%s).Observe(%s.Since(%s).Seconds())\n", recv, metricsField, method, timePkg, start)
+		fmt.Fprintf(&b, "%s.%s.Calls.WithLabelValues(%s).Inc()\n", recv, metricsField, method)
+		if d.returnsError() {
+			fmt.Fprintf(&b, "if %s != nil {\n%s.%s.Errors.WithLabelValues(%s).Inc()\n}\n", vars[len(vars)-1], recv, metricsField, method)
+		}
+		if len(vars) > 0 {
+			fmt.Fprintf(&b, "return %s\n", strings.Join(vars, ", "))
+		}
+		b.WriteString("}\n")
+	}
+	return FormatCode(b.String())
+}
@@ -0,0 +1,172 @@
+package maker
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// gomockImport is the import path of the gomock package used by the
+// generated mocks.
+const gomockImport = "go.uber.org/mock/gomock"
+
+// typeParamNames turns a type parameter list such as "[K comparable, V any]"
+// into the list of arguments instantiating it with the same names, "[K, V]".
+func typeParamNames(typeParams string) (string, error) {
+	if typeParams == "" {
+		return "", nil
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", "package p\ntype _"+typeParams+" struct{}", 0)
+	if err != nil {
+		return "", fmt.Errorf("invalid type parameters %q: %w", typeParams, err)
+	}
+	var names []string
+	for _, field := range f.Decls[0].(*ast.GenDecl).Specs[0].(*ast.TypeSpec).TypeParams.List {
+		for _, n := range field.Names {
+			names = append(names, n.Name)
+		}
+	}
+	return "[" + strings.Join(names, ", ") + "]", nil
+}
+
+// MakeMock generates a gomock compatible mock of the interface described
+// by options. The mock belongs to the same package as the interface and is
+// meant to be written to a separate file next to it.
+func MakeMock(options MakeOptions) ([]byte, error) {
+	return NewGenerator().MakeMock(options)
+}
+
+// MakeMock generates a gomock compatible mock of the interface described
+// by options, see MakeMock.
+func (g *Generator) MakeMock(options MakeOptions) ([]byte, error) {
+	data, err := g.cache.collectImplemented(options)
+	if err != nil {
+		return nil, err
+	}
+	return RenderMock(data, options)
+}
+
+// RenderMock renders the mock of iface, see MakeMock. Options are not used.
+func RenderMock(iface *Interface, options MakeOptions) ([]byte, error) {
+	if err := checkImplemented(iface, "mock"); err != nil {
+		return nil, err
+	}
+	return MakeMockCode(iface.Comment, iface.PkgName, iface.IfaceName, iface.TypeParams, iface.Methods, iface.Imports)
+}
+
+// MakeMockCode generates a gomock compatible mock, MockX with its recorder
+// MockXMockRecorder, implementing the interface ifaceName made of methods,
+// whose signatures are described by their Params and Results, or parsed
+// from their Code when both are empty. typeParams and imports are the ones
+// of the interface, the mock is meant to live in the same package pkgName.
+func MakeMockCode(comment, pkgName, ifaceName, typeParams string, methods []Method, imports []string) ([]byte, error) {
+	targs, err := typeParamNames(typeParams)
+	if err != nil {
+		return nil, err
+	}
+	mock := "Mock" + ifaceName
+	recorder := mock + "MockRecorder"
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %s\n\npackage %s\n\nimport (\n", comment, pkgName)
+	for _, i := range imports {
+		b.WriteString(i + "\n")
+	}
+	for _, i := range []string{"reflect", gomockImport} {
+		if q := strconv.Quote(i); !slices.Contains(imports, q) {
+			b.WriteString(q + "\n")
+		}
+	}
+	b.WriteString(")\n\n")
+
+	fmt.Fprintf(&b, "// %s is a mock of %s interface.\n", mock, ifaceName)
+	fmt.Fprintf(&b, "type %s%s struct {\nctrl *gomock.Controller\nrecorder *%s%s\n}\n\n", mock, typeParams, recorder, targs)
+	fmt.Fprintf(&b, "// %s is the mock recorder for %s.\n", recorder, mock)
+	fmt.Fprintf(&b, "type %s%s struct {\nmock *%s%s\n}\n\n", recorder, typeParams, mock, targs)
+	fmt.Fprintf(&b, "// New%s creates a new mock instance.\n", mock)
+	fmt.Fprintf(&b, "func New%s%s(ctrl *gomock.Controller) *%s%s {\n", mock, typeParams, mock, targs)
+	fmt.Fprintf(&b, "mock := &%s%s{ctrl: ctrl}\nmock.recorder = &%s%s{mock}\nreturn mock\n}\n\n", mock, targs, recorder, targs)
+	b.WriteString("// EXPECT returns an object that allows the caller to indicate expected use.\n")
+	fmt.Fprintf(&b, "func (m *%s%s) EXPECT() *%s%s {\nreturn m.recorder\n}\n", mock, targs, recorder, targs)
+
+	for _, m := range methods {
+		params, results := m.Params, m.Results
+		if len(params) == 0 && len(results) == 0 && m.Code != "" {
+			if params, results, err = parseMethodCode(m.Code, nil); err != nil {
+				return nil, err
+			}
+		}
+		variadic := len(params) > 0 && params[len(params)-1].Variadic
+
+		var (
+			args      []string // arguments of the mocked method
+			argNames  []string // argument names passed on to gomock
+			anyArgs   string   // arguments of the recorder method
+			resTypes  []string
+			retValues []string
+		)
+		for i, p := range params {
+			name := fmt.Sprintf("arg%d", i)
+			argNames = append(argNames, name)
+			if p.Variadic {
+				args = append(args, fmt.Sprintf("%s ...%s", name, p.Type))
+			} else {
+				args = append(args, fmt.Sprintf("%s %s", name, p.Type))
+			}
+		}
+		if variadic {
+			last := len(argNames) - 1
+			if last > 0 {
+				anyArgs = strings.Join(argNames[:last], ", ") + " any, "
+			}
+			anyArgs += argNames[last] + " ...any"
+		} else if len(argNames) > 0 {
+			anyArgs = strings.Join(argNames, ", ") + " any"
+		}
+		for i, r := range results {
+			resTypes = append(resTypes, r.Type)
+			retValues = append(retValues, fmt.Sprintf("ret%d", i))
+		}
+
+		// Mocked method.
+		fmt.Fprintf(&b, "\n// %s mocks base method.\n", m.Name)
+		fmt.Fprintf(&b, "func (m *%s%s) %s(%s) (%s) {\n", mock, targs, m.Name, strings.Join(args, ", "), strings.Join(resTypes, ", "))
+		b.WriteString("m.ctrl.T.Helper()\n")
+		callArgs := strings.Join(append([]string{"m", strconv.Quote(m.Name)}, argNames...), ", ")
+		if variadic {
+			last := argNames[len(argNames)-1]
+			fmt.Fprintf(&b, "varargs := []any{%s}\n", strings.Join(argNames[:len(argNames)-1], ", "))
+			fmt.Fprintf(&b, "for _, a := range %s {\nvarargs = append(varargs, a)\n}\n", last)
+			callArgs = fmt.Sprintf("m, %s, varargs...", strconv.Quote(m.Name))
+		}
+		if len(results) == 0 {
+			fmt.Fprintf(&b, "m.ctrl.Call(%s)\n}\n", callArgs)
+		} else {
+			fmt.Fprintf(&b, "ret := m.ctrl.Call(%s)\n", callArgs)
+			for i, r := range results {
+				fmt.Fprintf(&b, "ret%d, _ := ret[%d].(%s)\n", i, i, r.Type)
+			}
+			fmt.Fprintf(&b, "return %s\n}\n", strings.Join(retValues, ", "))
+		}
+
+		// Recorder method.
+		fmt.Fprintf(&b, "\n// %s indicates an expected call of %s.\n", m.Name, m.Name)
+		fmt.Fprintf(&b, "func (mr *%s%s) %s(%s) *gomock.Call {\n", recorder, targs, m.Name, anyArgs)
+		b.WriteString("mr.mock.ctrl.T.Helper()\n")
+		methodType := fmt.Sprintf("reflect.TypeOf((*%s%s)(nil).%s)", mock, targs, m.Name)
+		recordArgs := strings.Join(append([]string{"mr.mock", strconv.Quote(m.Name), methodType}, argNames...), ", ")
+		if variadic {
+			last := argNames[len(argNames)-1]
+			fmt.Fprintf(&b, "varargs := append([]any{%s}, %s...)\n", strings.Join(argNames[:len(argNames)-1], ", "), last)
+			recordArgs = fmt.Sprintf("mr.mock, %s, %s, varargs...", strconv.Quote(m.Name), methodType)
+		}
+		fmt.Fprintf(&b, "return mr.mock.ctrl.RecordCallWithMethodType(%s)\n}\n", recordArgs)
+	}
+
+	return FormatCode(b.String())
+}
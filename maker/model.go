@@ -0,0 +1,328 @@
+package maker
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Interface is the model of an interface collected from a source type,
+// everything needed to render it into a file.
+type Interface struct {
+	// Comment is the header comment of the file, without the leading "//".
+	Comment string
+	PkgName string
+	// Imports are import specs, e.g. `"io"` or `sq "database/sql"`.
+	Imports []string
+
+	IfaceName string
+	// IfaceComment is the doc comment of the interface, without the
+	// leading "//".
+	IfaceComment string
+	// TypeParams is the type parameter list of the interface,
+	// e.g. "[K comparable, V any]", or empty.
+	TypeParams string
+	// Embeds are the interfaces embedded in the interface, e.g.
+	// "io.Closer", when MakeOptions.EmbedInterfaces is set.
+	Embeds  []string
+	Methods []Method
+	// Roles are the role interfaces declared next to the interface, see
+	// MakeOptions.Roles. IfaceName is the composite interface embedding
+	// them, or empty. Methods are the methods of all roles.
+	Roles []Role
+
+	// StructName is the name of the source type, declared in the package
+	// named StructPkg. StructPath is the import path of that package when
+	// it is known.
+	StructName string
+	StructPkg  string
+	StructPath string
+	IsStruct   bool
+
+	// Warnings are problems found while collecting the interface that
+	// don't prevent generating it, e.g. ambiguous selectors.
+	Warnings []string
+
+	importModule string
+	// pkgPath is the import path of the generated package if it's known,
+	// see MakeOptions.PkgPath.
+	pkgPath string
+	// structDir is the directory of the file declaring the source type,
+	// the import path of its package can be derived from it.
+	structDir string
+	// structPathErr is the error looking up StructPath in structDir, it's
+	// only looked up once.
+	structPathErr error
+}
+
+// Analyze collects the interface described by options without rendering
+// it. Make is Analyze followed by Render.
+func Analyze(options MakeOptions) (*Interface, error) {
+	return NewGenerator().Analyze(options)
+}
+
+// Analyze collects the interface described by options, see Analyze.
+func (g *Generator) Analyze(options MakeOptions) (*Interface, error) {
+	return g.cache.collect(options)
+}
+
+// Render renders iface into a file with the template options.Template, or
+// DefaultTemplate, adding an assertion that the source type implements it
+// if options.Assert is set. Other options are not used.
+func Render(iface *Interface, options MakeOptions) ([]byte, error) {
+	tmpl, err := loadTemplate(options.Template)
+	if err != nil {
+		return nil, err
+	}
+	data := &TemplateData{Interface: *iface}
+	if len(iface.Roles) > 0 {
+		embeds, err := iface.roleEmbeds()
+		if err != nil {
+			return nil, err
+		}
+		data.Embeds = append(embeds, iface.Embeds...)
+		data.Methods = nil
+	}
+	if options.Assert {
+		qual, spec, err := iface.structQualifier()
+		if err != nil {
+			return nil, err
+		}
+		if spec != "" {
+			data.Imports = append(iface.Imports[:len(iface.Imports):len(iface.Imports)], spec)
+		}
+		if data.Assertion, err = iface.assertion("", qual); err != nil {
+			return nil, err
+		}
+	}
+	return RenderTemplate(tmpl, data)
+}
+
+// tupleParams describes the parameters or results of a signature.
+func tupleParams(tuple *types.Tuple, variadic bool, qf types.Qualifier) []Param {
+	var params []Param
+	for i := 0; i < tuple.Len(); i++ {
+		v := tuple.At(i)
+		p := Param{Name: v.Name()}
+		t := v.Type()
+		if variadic && i == tuple.Len()-1 {
+			if s, ok := t.(*types.Slice); ok {
+				t = s.Elem()
+				p.Variadic = true
+			}
+		}
+		p.Type = types.TypeString(t, qf)
+		p.PkgPath = typePkgPath(t)
+		params = append(params, p)
+	}
+	return params
+}
+
+// typePkgPath returns the import path of the package declaring the named
+// type t refers to, see Param.PkgPath.
+func typePkgPath(t types.Type) string {
+	for {
+		switch u := t.(type) {
+		case *types.Pointer:
+			t = u.Elem()
+		case *types.Slice:
+			t = u.Elem()
+		case *types.Array:
+			t = u.Elem()
+		case *types.Chan:
+			t = u.Elem()
+		case interface{ Obj() *types.TypeName }: // *types.Named and *types.Alias
+			if _, ok := t.(*types.TypeParam); ok || u.Obj().Pkg() == nil {
+				return ""
+			}
+			return u.Obj().Pkg().Path()
+		default:
+			return ""
+		}
+	}
+}
+
+// exprPkgPath returns the import path of the package declaring the named
+// type the type expression expr refers to, see Param.PkgPath. It's used
+// when no type information is available and resolves qualifiers with the
+// imports of the interface. Unqualified names that aren't predeclared or
+// type parameters belong to the package of the source type.
+func (d *Interface) exprPkgPath(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.ArrayType:
+			expr = e.Elt
+		case *ast.ChanType:
+			expr = e.Value
+		case *ast.Ellipsis:
+			expr = e.Elt
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.SelectorExpr:
+			x, ok := e.X.(*ast.Ident)
+			if !ok {
+				return ""
+			}
+			if p := importPathOf(d.Imports, x.Name); p != "" {
+				return p
+			}
+			if x.Name == d.StructPkg {
+				p, _ := d.structImportPath()
+				return p
+			}
+			return ""
+		case *ast.Ident:
+			if types.Universe.Lookup(e.Name) != nil || d.isTypeParam(e.Name) {
+				return ""
+			}
+			p, _ := d.structImportPath()
+			return p
+		default:
+			return ""
+		}
+	}
+}
+
+// importPathOf returns the import path of the import named name among the
+// import specs, or an empty string. Imports without an explicit name are
+// matched by importName.
+func importPathOf(specs []string, name string) string {
+	for _, spec := range specs {
+		alias, quoted := cutSpec(spec)
+		importPath, err := strconv.Unquote(quoted)
+		if err != nil {
+			continue
+		}
+		if alias == "" {
+			alias = importName(importPath)
+		}
+		if alias == name {
+			return importPath
+		}
+	}
+	return ""
+}
+
+// cutSpec splits an import spec, e.g. `sq "database/sql"`, into its alias,
+// empty if there is none, and its quoted path.
+func cutSpec(spec string) (alias, quoted string) {
+	if alias, quoted, ok := strings.Cut(spec, " "); ok {
+		return alias, quoted
+	}
+	return "", spec
+}
+
+// importName guesses the name of the package at importPath from the last
+// element of the path, ignoring a major version suffix such as "/v2" or
+// ".v3".
+func importName(importPath string) string {
+	name := path.Base(importPath)
+	if isMajorVersion(name) {
+		return path.Base(path.Dir(importPath))
+	}
+	if i := strings.LastIndex(name, "."); i > 0 && isMajorVersion(name[i+1:]) {
+		return name[:i]
+	}
+	return name
+}
+
+// isMajorVersion reports whether elem is a major version path element
+// such as "v2".
+func isMajorVersion(elem string) bool {
+	if len(elem) < 2 || elem[0] != 'v' {
+		return false
+	}
+	_, err := strconv.Atoi(elem[1:])
+	return err == nil
+}
+
+// isTypeParam reports whether name is one of the type parameters of the
+// interface.
+func (d *Interface) isTypeParam(name string) bool {
+	names, err := typeParamNames(d.TypeParams)
+	if err != nil || names == "" {
+		return false
+	}
+	for _, n := range strings.Split(strings.Trim(names, "[]"), ", ") {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// exprString renders a type expression as it appears in source.
+func exprString(fset *token.FileSet, expr ast.Expr) string {
+	var buf bytes.Buffer
+	_ = printer.Fprint(&buf, fset, expr)
+	return buf.String()
+}
+
+// parseMethodCode parses the Code of a Method, e.g. "Get(id string) (int, error)",
+// and returns its parameters and results flattened to one entry per value.
+// pkgPath, if not nil, resolves the Param.PkgPath of a type expression.
+func parseMethodCode(code string, pkgPath func(ast.Expr) string) (params, results []Param, err error) {
+	i := strings.Index(code, "(")
+	if i < 0 {
+		return nil, nil, fmt.Errorf("invalid method %q", code)
+	}
+	fset := token.NewFileSet()
+	expr, err := parser.ParseExprFrom(fset, "", "func"+code[i:], 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid method %q: %w", code, err)
+	}
+	ft, ok := expr.(*ast.FuncType)
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid method %q", code)
+	}
+	flatten := func(fl *ast.FieldList) []Param {
+		if fl == nil {
+			return nil
+		}
+		var out []Param
+		for _, f := range fl.List {
+			p := Param{Type: exprString(fset, f.Type)}
+			if e, ok := f.Type.(*ast.Ellipsis); ok {
+				p = Param{Type: exprString(fset, e.Elt), Variadic: true}
+			}
+			if pkgPath != nil {
+				p.PkgPath = pkgPath(f.Type)
+			}
+			if len(f.Names) == 0 {
+				out = append(out, p)
+			}
+			for _, n := range f.Names {
+				p.Name = n.Name
+				out = append(out, p)
+			}
+		}
+		return out
+	}
+	return flatten(ft.Params), flatten(ft.Results), nil
+}
+
+// parseSignatures fills in the Params and Results of the methods from
+// their Code, parsing up to workers methods at a time.
+func (d *Interface) parseSignatures(workers int) error {
+	return parallel(len(d.Methods), workers, func(i int) error {
+		params, results, err := parseMethodCode(d.Methods[i].Code, d.exprPkgPath)
+		if err != nil {
+			return err
+		}
+		d.Methods[i].Params, d.Methods[i].Results = params, results
+		return nil
+	})
+}
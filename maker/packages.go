@@ -0,0 +1,790 @@
+package maker
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/token"
+	"go/types"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// loadMode is the set of go/packages facts needed to render method
+// signatures from type information while still being able to copy
+// docs from the syntax trees of the loaded package.
+const loadMode = packages.NeedName |
+	packages.NeedFiles |
+	packages.NeedSyntax |
+	packages.NeedTypes |
+	packages.NeedTypesInfo |
+	packages.NeedImports
+
+// LoadPackage loads a single package matching the given import pattern
+// with full type information. The pattern is resolved relative to dir,
+// or to the current working directory when dir is empty.
+func LoadPackage(dir, pattern string) (*packages.Package, error) {
+	return LoadPackageFor(dir, pattern, BuildConfig{})
+}
+
+// LoadPackageFor is like LoadPackage, selecting the files of the package
+// according to b.
+func LoadPackageFor(dir, pattern string, b BuildConfig) (*packages.Package, error) {
+	cfg := &packages.Config{
+		Mode:       loadMode,
+		Dir:        dir,
+		Env:        b.env(),
+		BuildFlags: b.buildFlags(),
+		Tests:      b.Tests,
+	}
+	pkgs, err := packages.Load(cfg, pattern)
+	if err != nil {
+		return nil, err
+	}
+	if b.Tests {
+		pkgs = testVariants(pkgs)
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("pattern %q matched %d packages, expected exactly one", pattern, len(pkgs))
+	}
+	pkg := pkgs[0]
+	if len(pkg.Errors) > 0 {
+		// Build failures reported by the go command repeat the parse and
+		// type errors without a usable position, so they are only reported
+		// when there is nothing more specific.
+		var errs, listErrs []error
+		for _, e := range pkg.Errors {
+			if e.Kind == packages.ListError {
+				listErrs = append(listErrs, packageError(e, ""))
+			} else {
+				errs = append(errs, packageError(e, ""))
+			}
+		}
+		if len(errs) == 0 {
+			errs = listErrs
+		}
+		return nil, errors.Join(errs...)
+	}
+	return pkg, nil
+}
+
+// importTracker collects the imports required by the types referenced
+// in the rendered method signatures and hands out a unique local name
+// for each imported package.
+type importTracker struct {
+	names map[string]string // import path -> local name
+	used  map[string]string // local name -> import path
+	specs []string
+	// unaliased holds the import paths reserved without an alias.
+	unaliased map[string]bool
+}
+
+func newImportTracker() *importTracker {
+	return &importTracker{
+		names:     make(map[string]string),
+		used:      make(map[string]string),
+		unaliased: make(map[string]bool),
+	}
+}
+
+// add registers the package and returns the name it has to be referred to.
+func (it *importTracker) add(pkg *types.Package) string {
+	if name, ok := it.names[pkg.Path()]; ok {
+		return name
+	}
+	name := pkg.Name()
+	for i := 2; ; i++ {
+		if p, taken := it.used[name]; !taken || p == pkg.Path() {
+			break
+		}
+		name = fmt.Sprintf("%s%d", pkg.Name(), i)
+	}
+	it.names[pkg.Path()] = name
+	it.used[name] = pkg.Path()
+	// A package imported without an alias keeps the spec of the file, even
+	// if its name isn't the last element of its path.
+	if name == path.Base(pkg.Path()) || (it.unaliased[pkg.Path()] && name == pkg.Name()) {
+		it.specs = append(it.specs, strconv.Quote(pkg.Path()))
+	} else {
+		it.specs = append(it.specs, fmt.Sprintf("%s %s", name, strconv.Quote(pkg.Path())))
+	}
+	return name
+}
+
+// qualifier returns a types.Qualifier used to render type expressions as
+// they have to appear in the generated package named pkgName, whose import
+// path is pkgPath if it's known. Types of that package are left
+// unqualified, as are the ones of the source package src when it's
+// dot-imported through importModule. Without pkgPath, the interface is
+// only assumed to be generated into src when pkgName is its name, other
+// packages named pkgName are still imported.
+func (it *importTracker) qualifier(src *types.Package, pkgName, pkgPath, importModule string) types.Qualifier {
+	return func(p *types.Package) string {
+		if p == src && importModule != "" {
+			return ""
+		}
+		if pkgPath != "" && p.Path() == pkgPath {
+			return ""
+		}
+		if pkgPath == "" && p == src && p.Name() == pkgName {
+			return ""
+		}
+		return it.add(p)
+	}
+}
+
+// testVariants replaces packages with their variant compiled for tests,
+// which includes their _test.go files, and drops the external test packages
+// and test binaries go/packages loads along with them.
+func testVariants(pkgs []*packages.Package) []*packages.Package {
+	variants := make(map[string]*packages.Package)
+	for _, p := range pkgs {
+		if p.ID == fmt.Sprintf("%s [%s.test]", p.PkgPath, p.PkgPath) {
+			variants[p.PkgPath] = p
+		}
+	}
+	var out []*packages.Package
+	for _, p := range pkgs {
+		if p.ID != p.PkgPath || strings.HasSuffix(p.PkgPath, ".test") {
+			continue
+		}
+		if v, ok := variants[p.PkgPath]; ok {
+			p = v
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// FormatSignature renders a method named name with the given signature in
+// the form used inside of an interface declaration, e.g.
+// "Get(ctx context.Context, id string) (*User, error)".
+func FormatSignature(name string, sig *types.Signature, qf types.Qualifier) string {
+	params := formatTuple(sig.Params(), sig.Variadic(), qf)
+	results := formatTuple(sig.Results(), false, qf)
+	if len(results) == 0 {
+		return fmt.Sprintf("%s(%s)", name, strings.Join(params, ", "))
+	}
+	return fmt.Sprintf("%s(%s) (%s)", name, strings.Join(params, ", "), strings.Join(results, ", "))
+}
+
+// formatTuple renders the parameters or results of a signature. Consecutive
+// named entries sharing the same type are grouped together the way they are
+// usually written in source, e.g. "name, telephone string".
+func formatTuple(tuple *types.Tuple, variadic bool, qf types.Qualifier) []string {
+	var (
+		parts []string
+		names []string
+		last  string
+	)
+	flush := func() {
+		if len(names) > 0 {
+			parts = append(parts, fmt.Sprintf("%s %s", strings.Join(names, ", "), last))
+			names = nil
+		}
+	}
+	for i := 0; i < tuple.Len(); i++ {
+		v := tuple.At(i)
+		var t string
+		if variadic && i == tuple.Len()-1 {
+			if s, ok := v.Type().(*types.Slice); ok {
+				t = "..." + types.TypeString(s.Elem(), qf)
+			}
+		}
+		if t == "" {
+			t = types.TypeString(v.Type(), qf)
+		}
+		if v.Name() == "" {
+			flush()
+			parts = append(parts, t)
+			continue
+		}
+		if len(names) > 0 && t != last {
+			flush()
+		}
+		names = append(names, v.Name())
+		last = t
+	}
+	flush()
+	return parts
+}
+
+// formatTypeParams renders the type parameter list of a generic type,
+// e.g. "[K comparable, V any]". It returns an empty string for
+// non-generic types.
+func formatTypeParams(tparams *types.TypeParamList, qf types.Qualifier) string {
+	if tparams.Len() == 0 {
+		return ""
+	}
+	parts := make([]string, tparams.Len())
+	for i := 0; i < tparams.Len(); i++ {
+		tp := tparams.At(i)
+		parts[i] = fmt.Sprintf("%s %s", tp.Obj().Name(), types.TypeString(tp.Constraint(), qf))
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// methodComments maps every method declared in the package, by a function
+// declaration or in an interface type, to its doc comment so that docs can
+// be copied from source. The methods are keyed by methodKey, so that they
+// are found from any load of the package.
+func methodComments(pkg *packages.Package) map[string]*ast.CommentGroup {
+	docs := make(map[string]*ast.CommentGroup)
+	for _, f := range pkg.Syntax {
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncDecl:
+				if fn, ok := pkg.TypesInfo.Defs[n.Name].(*types.Func); ok && n.Recv != nil {
+					docs[methodKey(fn)] = n.Doc
+				}
+				return false
+			case *ast.InterfaceType:
+				for _, field := range n.Methods.List {
+					for _, name := range field.Names {
+						if fn, ok := pkg.TypesInfo.Defs[name].(*types.Func); ok {
+							docs[methodKey(fn)] = field.Doc
+						}
+					}
+				}
+			}
+			return true
+		})
+	}
+	return docs
+}
+
+// methodKey identifies a method within its package by the name of its
+// receiver type and its own, e.g. "Mutex.Lock".
+func methodKey(fn *types.Func) string {
+	recv := fn.Origin().Type().(*types.Signature).Recv()
+	if recv == nil {
+		return fn.Name()
+	}
+	t := recv.Type()
+	if ptr, ok := types.Unalias(t).(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	if named, ok := types.Unalias(t).(*types.Named); ok {
+		return named.Obj().Name() + "." + fn.Name()
+	}
+	return fn.Name()
+}
+
+// methodComment returns the doc comment of the method fn found in pkg,
+// read from the syntax of the package declaring it: pkg itself or another
+// package, which is then loaded in dir with the build configuration b. It
+// returns nil if that package can't be loaded.
+func (c *sourceCache) methodComment(pkg *packages.Package, fn *types.Func, dir string, b BuildConfig) *ast.CommentGroup {
+	if fn.Pkg() != nil && fn.Pkg().Path() != pkg.PkgPath {
+		var err error
+		if pkg, err = c.loadPackage(dir, fn.Pkg().Path(), b); err != nil {
+			return nil
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	docs, ok := c.comments[pkg]
+	if !ok {
+		docs = methodComments(pkg)
+		c.comments[pkg] = docs
+	}
+	return docs[methodKey(fn)]
+}
+
+// positionLess reports whether the declaration at a comes before the one
+// at b, comparing file names and lines rather than positions, which only
+// compare within a FileSet in the order its files are loaded.
+func positionLess(fset *token.FileSet, a, b token.Pos) bool {
+	pa, pb := fset.Position(a), fset.Position(b)
+	if pa.Filename != pb.Filename {
+		return pa.Filename < pb.Filename
+	}
+	if pa.Line != pb.Line {
+		return pa.Line < pb.Line
+	}
+	return pa.Column < pb.Column
+}
+
+// methodDocs returns the lines of the doc comment of a method
+// without go and ifacemaker directives.
+func methodDocs(doc *ast.CommentGroup) []string {
+	if doc == nil {
+		return nil
+	}
+	var docs []string
+	for _, c := range doc.List {
+		if !isDirective(c.Text) {
+			docs = append(docs, c.Text)
+		}
+	}
+	return docs
+}
+
+// typeDocOf returns the doc comment of the named type declared in pkg.
+func typeDocOf(pkg *packages.Package, typeName string) string {
+	pkgDoc, err := doc.NewFromFiles(pkg.Fset, pkg.Syntax, pkg.PkgPath, doc.AllDecls)
+	if err != nil {
+		return ""
+	}
+	for _, t := range pkgDoc.Types {
+		if t.Name == typeName {
+			return strings.TrimSuffix(t.Doc, "\n")
+		}
+	}
+	return ""
+}
+
+// ParsePackageType collects the methods of the named type typeName declared
+// in pkg. The method signatures are rendered from type information, so
+// qualifiers, aliases and imported types always match the declaration.
+// Promoted methods of embedded types are included when withPromoted is set.
+// It returns the methods in declaration order, the imports they require,
+// the type doc (when copyTypeDocs is set) and the type parameters of the
+// type.
+func ParsePackageType(pkg *packages.Package, typeName string, copyDocs bool, copyTypeDocs bool, pkgName string, importModule string, withNotExported bool, withPromoted bool) (methods []Method, imports []string, typeDoc string, typeParams string, err error) {
+	c := newSourceCache()
+	comment := func(fn *types.Func) *ast.CommentGroup {
+		return c.methodComment(pkg, fn, pkg.Dir, BuildConfig{})
+	}
+	return parsePackageType(pkg, typeName, copyDocs, copyTypeDocs, pkgName, "", importModule, withNotExported, withPromoted, comment)
+}
+
+// parsePackageType implements ParsePackageType for an interface generated
+// into the package at pkgPath, if it's known. comment returns the doc
+// comment of a method of the type.
+func parsePackageType(pkg *packages.Package, typeName string, copyDocs bool, copyTypeDocs bool, pkgName string, pkgPath string, importModule string, withNotExported bool, withPromoted bool, comment func(fn *types.Func) *ast.CommentGroup) (methods []Method, imports []string, typeDoc string, typeParams string, err error) {
+	obj, ok := pkg.Types.Scope().Lookup(typeName).(*types.TypeName)
+	if !ok {
+		return nil, nil, "", "", fmt.Errorf("%q structtype not found in package %s", typeName, pkg.PkgPath)
+	}
+	named, ok := obj.Type().(*types.Named)
+	if !ok {
+		return nil, nil, "", "", fmt.Errorf("%q is not a named type in package %s", typeName, pkg.PkgPath)
+	}
+
+	it := newImportTracker()
+	qf := it.qualifier(pkg.Types, pkgName, pkgPath, importModule)
+
+	// Instantiate generic types with their own type parameters, so that the
+	// method signatures refer to the parameter names of the type declaration
+	// rather than to the ones chosen by each method receiver.
+	var recv types.Type = named
+	if tparams := named.TypeParams(); tparams.Len() > 0 {
+		targs := make([]types.Type, tparams.Len())
+		for i := range targs {
+			targs[i] = tparams.At(i)
+		}
+		recv, err = types.Instantiate(nil, named, targs, false)
+		if err != nil {
+			return nil, nil, "", "", err
+		}
+		typeParams = formatTypeParams(tparams, qf)
+	}
+	if !types.IsInterface(recv) {
+		recv = types.NewPointer(recv)
+	}
+
+	var direct, promoted []*types.Selection
+	mset := types.NewMethodSet(recv)
+	for i := 0; i < mset.Len(); i++ {
+		sel := mset.At(i)
+		fn := sel.Obj().(*types.Func)
+		if !fn.Exported() && (!withNotExported || fn.Pkg() != pkg.Types) {
+			continue
+		}
+		if len(sel.Index()) == 1 {
+			direct = append(direct, sel)
+		} else if withPromoted {
+			promoted = append(promoted, sel)
+		}
+	}
+	sort.SliceStable(direct, func(i, j int) bool {
+		return direct[i].Obj().Pos() < direct[j].Obj().Pos()
+	})
+	// Promoted methods are ordered like in file mode: the ones of the types
+	// of pkg first, in source order, then the ones of each type of another
+	// package, in the breadth-first order of the embedded fields, in source
+	// order by depth.
+	paths := make(map[*types.Selection][]int, len(promoted))
+	for _, sel := range promoted {
+		paths[sel] = externalPath(recv, sel.Index(), pkg.Types)
+	}
+	sort.SliceStable(promoted, func(i, j int) bool {
+		a, b := promoted[i], promoted[j]
+		pa, pb := paths[a], paths[b]
+		if len(pa) != len(pb) {
+			return len(pa) < len(pb)
+		}
+		if c := slices.Compare(pa, pb); c != 0 {
+			return c < 0
+		}
+		if pa != nil && len(a.Index()) != len(b.Index()) {
+			return len(a.Index()) < len(b.Index())
+		}
+		return positionLess(pkg.Fset, a.Obj().Pos(), b.Obj().Pos())
+	})
+
+	// Methods missing from the method set of the value type require a
+	// pointer to implement the interface.
+	valueSet := types.NewMethodSet(recv)
+	if ptr, ok := recv.(*types.Pointer); ok {
+		valueSet = types.NewMethodSet(ptr.Elem())
+	}
+
+	for _, sel := range append(direct, promoted...) {
+		fn := sel.Obj().(*types.Func)
+		doc := comment(fn)
+		var docs []string
+		if copyDocs {
+			docs = methodDocs(doc)
+		}
+		sig := fn.Type().(*types.Signature)
+		methods = append(methods, Method{
+			Name:            fn.Name(),
+			Code:            FormatSignature(fn.Name(), sig, qf),
+			Docs:            docs,
+			PointerReceiver: valueSet.Lookup(fn.Pkg(), fn.Name()) == nil,
+			Params:          tupleParams(sig.Params(), sig.Variadic(), qf),
+			Results:         tupleParams(sig.Results(), false, qf),
+			Directives:      methodDirectives(doc),
+		})
+	}
+
+	imports = it.specs
+	if importModule != "" {
+		imports = append(imports, fmt.Sprintf(". %s", strconv.Quote(importModule)))
+	}
+
+	if copyTypeDocs {
+		typeDoc = typeDocOf(pkg, typeName)
+	}
+	return methods, imports, typeDoc, typeParams, nil
+}
+
+// isStruct reports whether the type typeName declared in pkg is a struct.
+func isStruct(pkg *packages.Package, typeName string) bool {
+	obj := pkg.Types.Scope().Lookup(typeName)
+	if obj == nil {
+		return false
+	}
+	_, ok := obj.Type().Underlying().(*types.Struct)
+	return ok
+}
+
+// SplitTypeRef splits a fully qualified type reference of the form
+// "importpath.TypeName", e.g. "database/sql.DB" or
+// "github.com/redis/go-redis/v9.Client", into the import path and the type
+// name. A leading "*" is ignored.
+func SplitTypeRef(ref string) (pkgPath string, typeName string, err error) {
+	ref = strings.TrimPrefix(ref, "*")
+	slash := strings.LastIndex(ref, "/")
+	dot := strings.LastIndex(ref, ".")
+	if dot <= slash || dot == len(ref)-1 {
+		return "", "", fmt.Errorf("invalid type reference %q, expected importpath.TypeName", ref)
+	}
+	return ref[:dot], ref[dot+1:], nil
+}
+
+// collectFromPackage implements collect for the MakeOptions.Package and
+// MakeOptions.Type loading modes.
+func (c *sourceCache) collectFromPackage(options MakeOptions) (*Interface, error) {
+	if options.Type != "" {
+		pkgPath, typeName, err := SplitTypeRef(options.Type)
+		if err != nil {
+			return nil, err
+		}
+		// Types from other packages are used through their full method set,
+		// unexported methods can't be part of an interface implemented by
+		// them outside of their own package.
+		options.Package = pkgPath
+		options.StructType = typeName
+		options.WithPromoted = true
+		options.WithNotExported = false
+	}
+
+	pkg, err := c.loadPackage(options.Dir, options.Package, options.Build)
+	if err != nil {
+		return nil, withStruct(err, options.StructType)
+	}
+
+	comment := func(fn *types.Func) *ast.CommentGroup {
+		return c.methodComment(pkg, fn, options.Dir, options.Build)
+	}
+	methods, imports, typeDoc, typeParams, err := parsePackageType(pkg, options.StructType, options.CopyDocs, options.CopyTypeDoc, options.PkgName, options.PkgPath, options.ImportModule, options.WithNotExported, options.WithPromoted, comment)
+	if err != nil {
+		return nil, err
+	}
+
+	excludedMethods := excludedSet(options)
+	var included []Method
+	for _, m := range methods {
+		if _, ok := excludedMethods[m.Name]; !ok {
+			included = append(included, m)
+		}
+	}
+
+	var warnings []string
+	if options.WithPromoted {
+		warnings = ambiguousSelectors(pkg, options.StructType)
+	}
+
+	var embeds []string
+	if options.WithPromoted && options.EmbedInterfaces {
+		included, embeds, imports = embedInterfaces(pkg, options, included, imports)
+	}
+
+	if typeDoc != "" {
+		options.IfaceComment = fmt.Sprintf("%s\n%s", options.IfaceComment, typeDoc)
+	}
+
+	return &Interface{
+		Comment:      options.Comment,
+		PkgName:      options.PkgName,
+		IfaceName:    options.IfaceName,
+		IfaceComment: options.IfaceComment,
+		TypeParams:   typeParams,
+		Embeds:       embeds,
+		Methods:      included,
+		Imports:      imports,
+		StructName:   options.StructType,
+		StructPkg:    pkg.Name,
+		StructPath:   pkg.PkgPath,
+		IsStruct:     isStruct(pkg, options.StructType),
+		Warnings:     warnings,
+		importModule: options.ImportModule,
+		pkgPath:      options.PkgPath,
+	}, nil
+}
+
+// embedInterfaces replaces the methods promoted from interfaces embedded in
+// the type options.StructType of pkg by the references to these
+// interfaces. It returns the remaining methods, the embedded interfaces and
+// imports extended with the ones they require.
+func embedInterfaces(pkg *packages.Package, options MakeOptions, methods []Method, imports []string) ([]Method, []string, []string) {
+	recv := pkg.Types.Scope().Lookup(options.StructType).Type()
+	if !types.IsInterface(recv) {
+		recv = types.NewPointer(recv)
+	}
+	it := newImportTracker()
+	for _, spec := range imports {
+		it.reserve(spec)
+	}
+	qf := it.qualifier(pkg.Types, options.PkgName, options.PkgPath, options.ImportModule)
+
+	var (
+		kept   []Method
+		embeds []string
+		paths  = make(map[string][]int)
+	)
+	for _, m := range methods {
+		_, index, _ := types.LookupFieldOrMethod(recv, true, pkg.Types, m.Name)
+		if field, path := embeddingInterface(recv, index); field != nil {
+			if ref := types.TypeString(field.Type(), qf); !slices.Contains(embeds, ref) {
+				embeds = append(embeds, ref)
+				paths[ref] = path
+			}
+			continue
+		}
+		kept = append(kept, m)
+	}
+	// The interfaces are embedded in the breadth-first order of the
+	// embedded fields, like in file mode.
+	sort.SliceStable(embeds, func(i, j int) bool {
+		a, b := paths[embeds[i]], paths[embeds[j]]
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return slices.Compare(a, b) < 0
+	})
+	for _, spec := range it.specs {
+		if !slices.Contains(imports, spec) {
+			imports = append(imports, spec)
+		}
+	}
+	return kept, embeds, imports
+}
+
+// externalPath follows the path index of a method promoted to t through the
+// embedded fields of t, and returns the part of it leading to the first
+// embedded type of another package than pkg, or nil if the method isn't
+// promoted from one.
+func externalPath(t types.Type, index []int, pkg *types.Package) []int {
+	for i := 0; i < len(index)-1; i++ {
+		if ptr, ok := types.Unalias(t).(*types.Pointer); ok {
+			t = ptr.Elem()
+		}
+		st, ok := t.Underlying().(*types.Struct)
+		if !ok {
+			return nil
+		}
+		t = st.Field(index[i]).Type()
+		named := t
+		if ptr, ok := types.Unalias(named).(*types.Pointer); ok {
+			named = ptr.Elem()
+		}
+		if n, ok := types.Unalias(named).(*types.Named); ok && n.Obj().Pkg() != pkg {
+			return index[:i+1]
+		}
+	}
+	return nil
+}
+
+// embeddingInterface follows the path index of a method promoted to t
+// through the embedded fields of t, and returns the first embedded
+// interface on the way with the part of index leading to it, or nil if the
+// method isn't promoted from one.
+func embeddingInterface(t types.Type, index []int) (*types.Var, []int) {
+	for i := 0; i < len(index)-1; i++ {
+		if ptr, ok := types.Unalias(t).(*types.Pointer); ok {
+			t = ptr.Elem()
+		}
+		st, ok := t.Underlying().(*types.Struct)
+		if !ok {
+			return nil, nil
+		}
+		field := st.Field(index[i])
+		if types.IsInterface(field.Type()) {
+			return field, index[:i+1]
+		}
+		t = field.Type()
+	}
+	return nil, nil
+}
+
+// ambiguousSelectors reports the methods of the types embedded in the type
+// typeName of pkg that aren't promoted because they're found more than
+// once at the same depth.
+func ambiguousSelectors(pkg *packages.Package, typeName string) []string {
+	named := pkg.Types.Scope().Lookup(typeName).Type()
+	recv := types.NewPointer(named)
+	var (
+		warnings []string
+		names    = make(map[string]struct{})
+		seen     = make(map[types.Type]struct{})
+	)
+	var walk func(t types.Type)
+	walk = func(t types.Type) {
+		if ptr, ok := types.Unalias(t).(*types.Pointer); ok {
+			t = ptr.Elem()
+		}
+		if _, ok := seen[t]; ok {
+			return
+		}
+		seen[t] = struct{}{}
+		st, ok := t.Underlying().(*types.Struct)
+		if !ok {
+			return
+		}
+		for i := 0; i < st.NumFields(); i++ {
+			f := st.Field(i)
+			if !f.Embedded() {
+				continue
+			}
+			ft := f.Type()
+			if !types.IsInterface(ft) {
+				if _, ok := types.Unalias(ft).(*types.Pointer); !ok {
+					ft = types.NewPointer(ft)
+				}
+			}
+			mset := types.NewMethodSet(ft)
+			for j := 0; j < mset.Len(); j++ {
+				fn := mset.At(j).Obj()
+				if _, ok := names[fn.Name()]; ok {
+					continue
+				}
+				names[fn.Name()] = struct{}{}
+				obj, index, _ := types.LookupFieldOrMethod(recv, true, fn.Pkg(), fn.Name())
+				if obj != nil || index == nil {
+					continue
+				}
+				if from, hasMethod := shallowestSelectors(named, fn.Name(), pkg.Types); hasMethod {
+					warnings = append(warnings, ambiguousSelector(typeName, fn.Name(), from))
+				}
+			}
+			walk(f.Type())
+		}
+	}
+	walk(named)
+	return warnings
+}
+
+// shallowestSelectors returns the names, qualified relative to pkg, of the
+// types embedded in the struct type t that have a method or a field named
+// name at the smallest depth, and whether one of them is a method, like
+// the promoter does for file mode.
+func shallowestSelectors(t types.Type, name string, pkg *types.Package) (from []string, hasMethod bool) {
+	seen := make(map[types.Type]struct{})
+	for level := []types.Type{t}; len(level) > 0 && len(from) == 0; {
+		var next []types.Type
+		for _, t := range level {
+			st, ok := t.Underlying().(*types.Struct)
+			if !ok {
+				continue
+			}
+			for i := 0; i < st.NumFields(); i++ {
+				f := st.Field(i)
+				if !f.Embedded() {
+					continue
+				}
+				ft := f.Type()
+				if ptr, ok := types.Unalias(ft).(*types.Pointer); ok {
+					ft = ptr.Elem()
+				}
+				if _, ok := seen[ft]; ok {
+					continue
+				}
+				seen[ft] = struct{}{}
+				next = append(next, ft)
+				method, found := declares(ft, name)
+				if !found {
+					continue
+				}
+				hasMethod = hasMethod || method
+				named, ok := types.Unalias(ft).(*types.Named)
+				if !ok {
+					from = append(from, types.TypeString(ft, types.RelativeTo(pkg)))
+				} else if obj := named.Obj(); obj.Pkg() == pkg {
+					from = append(from, obj.Name())
+				} else {
+					from = append(from, obj.Pkg().Name()+"."+obj.Name())
+				}
+			}
+		}
+		level = next
+	}
+	return from, hasMethod
+}
+
+// declares reports whether the type t itself, not the types it embeds,
+// has a method or a field named name, and whether it's a method.
+func declares(t types.Type, name string) (method, found bool) {
+	if iface, ok := t.Underlying().(*types.Interface); ok {
+		for i := 0; i < iface.NumMethods(); i++ {
+			if iface.Method(i).Name() == name {
+				return true, true
+			}
+		}
+		return false, false
+	}
+	if named, ok := types.Unalias(t).(*types.Named); ok {
+		for i := 0; i < named.NumMethods(); i++ {
+			if named.Method(i).Name() == name {
+				return true, true
+			}
+		}
+	}
+	if st, ok := t.Underlying().(*types.Struct); ok {
+		for i := 0; i < st.NumFields(); i++ {
+			if st.Field(i).Name() == name {
+				return false, true
+			}
+		}
+	}
+	return false, false
+}
@@ -0,0 +1,45 @@
+package maker
+
+import (
+	"runtime"
+	"sync"
+)
+
+// parallel calls fn for every index in [0, n) using at most workers
+// goroutines. A workers value below one means runtime.GOMAXPROCS(0). All
+// calls are made even when some fail, the error of the lowest index is
+// returned so that the result doesn't depend on scheduling.
+func parallel(n, workers int, fn func(i int) error) error {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	errs := make([]error, n)
+	if workers == 1 || n < 2 {
+		for i := range n {
+			errs[i] = fn(i)
+		}
+	} else {
+		var wg sync.WaitGroup
+		next := make(chan int)
+		for range min(workers, n) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range next {
+					errs[i] = fn(i)
+				}
+			}()
+		}
+		for i := range n {
+			next <- i
+		}
+		close(next)
+		wg.Wait()
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
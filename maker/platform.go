@@ -0,0 +1,135 @@
+package maker
+
+import (
+	"bytes"
+	"fmt"
+	"go/build/constraint"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// PlatformFile is a generated file shared by a group of platforms for
+// which the interface is the same.
+type PlatformFile struct {
+	// Platforms are the platforms, "GOOS" or "GOOS/GOARCH", using the file.
+	Platforms []string
+	// Constraint is the //go:build line restricting the file to Platforms,
+	// it is empty when all of the platforms share one file.
+	Constraint string
+	Code       []byte
+	// Warnings are the warnings of the interface of any of Platforms, see
+	// Interface.Warnings.
+	Warnings []string
+}
+
+// splitPlatform splits a platform "GOOS" or "GOOS/GOARCH".
+func splitPlatform(platform string) (goos, goarch string, err error) {
+	goos, goarch, _ = strings.Cut(platform, "/")
+	if goos == "" || strings.Contains(goarch, "/") || (strings.Contains(platform, "/") && goarch == "") {
+		return "", "", fmt.Errorf("invalid platform %q, expected GOOS or GOOS/GOARCH", platform)
+	}
+	return goos, goarch, nil
+}
+
+// platformConstraint returns the //go:build line matching any of the
+// platforms.
+func platformConstraint(platforms []string) string {
+	var expr constraint.Expr
+	for _, p := range platforms {
+		goos, goarch, _ := splitPlatform(p)
+		var x constraint.Expr = &constraint.TagExpr{Tag: goos}
+		if goarch != "" {
+			x = &constraint.AndExpr{X: x, Y: &constraint.TagExpr{Tag: goarch}}
+		}
+		if expr == nil {
+			expr = x
+		} else {
+			expr = &constraint.OrExpr{X: expr, Y: x}
+		}
+	}
+	return "//go:build " + expr.String()
+}
+
+// MatchFiles returns the files that are part of the build selected by b,
+// evaluating their //go:build lines and GOOS/GOARCH file name suffixes.
+func MatchFiles(files []string, b BuildConfig) ([]string, error) {
+	ctx := b.context("")
+	var matched []string
+	for _, f := range files {
+		ok, err := ctx.MatchFile(filepath.Dir(f), filepath.Base(f))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, f)
+		}
+	}
+	return matched, nil
+}
+
+// MakePlatforms generates the interface described by options for each of
+// the platforms, given as "GOOS" or "GOOS/GOARCH". Platforms with the same
+// interface share a file. If they all do, a single file without a build
+// constraint is returned, otherwise every file starts with a //go:build
+// line selecting its platforms. Other platforms get no file.
+func MakePlatforms(options MakeOptions, platforms []string) ([]PlatformFile, error) {
+	return NewGenerator().MakePlatforms(options, platforms)
+}
+
+// MakePlatforms generates the interface described by options for each of
+// the platforms, see MakePlatforms.
+func (g *Generator) MakePlatforms(options MakeOptions, platforms []string) ([]PlatformFile, error) {
+	if len(platforms) == 0 {
+		return nil, fmt.Errorf("no platforms given")
+	}
+	var files []PlatformFile
+	for _, p := range platforms {
+		goos, goarch, err := splitPlatform(p)
+		if err != nil {
+			return nil, err
+		}
+		opts := options
+		opts.Build.GOOS = goos
+		opts.Build.GOARCH = goarch
+		iface, err := g.cache.collect(opts)
+		if err != nil {
+			return nil, fmt.Errorf("platform %s: %w", p, err)
+		}
+		code, err := Render(iface, opts)
+		if err != nil {
+			return nil, fmt.Errorf("platform %s: %w", p, err)
+		}
+		i := slices.IndexFunc(files, func(f PlatformFile) bool { return bytes.Equal(f.Code, code) })
+		if i < 0 {
+			files = append(files, PlatformFile{Code: code})
+			i = len(files) - 1
+		}
+		files[i].Platforms = append(files[i].Platforms, p)
+		for _, w := range iface.Warnings {
+			if !slices.Contains(files[i].Warnings, w) {
+				files[i].Warnings = append(files[i].Warnings, w)
+			}
+		}
+	}
+	if len(files) > 1 {
+		for i := range files {
+			files[i].Constraint = platformConstraint(files[i].Platforms)
+			files[i].Code = append([]byte(files[i].Constraint+"\n\n"), files[i].Code...)
+		}
+	}
+	return files, nil
+}
+
+// PlatformFileName returns the name of the file for platforms derived from
+// output, e.g. "store.linux.go" or "store.linux-darwin_arm64.go" for
+// "store.go". The platforms are added after a dot, so that they don't turn
+// into an implicit GOOS/GOARCH file name constraint.
+func PlatformFileName(output string, platforms []string) string {
+	ext := filepath.Ext(output)
+	names := make([]string, len(platforms))
+	for i, p := range platforms {
+		names[i] = strings.ReplaceAll(p, "/", "_")
+	}
+	return strings.TrimSuffix(output, ext) + "." + strings.Join(names, "-") + ext
+}
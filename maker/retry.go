@@ -0,0 +1,132 @@
+package maker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MakeRetry generates a decorator of the interface described by options
+// calling the methods returning an error again while they fail. The
+// decorator is named after the interface, e.g. RetryStore, belongs to the
+// same package and is meant to be written to a separate file next to it.
+func MakeRetry(options MakeOptions) ([]byte, error) {
+	return NewGenerator().MakeRetry(options)
+}
+
+// MakeRetry generates a retrying decorator of the interface described by
+// options, see MakeRetry.
+func (g *Generator) MakeRetry(options MakeOptions) ([]byte, error) {
+	data, err := g.cache.collectImplemented(options)
+	if err != nil {
+		return nil, err
+	}
+	return RenderRetry(data, options)
+}
+
+// RenderRetry renders the retrying decorator of iface, see MakeRetry.
+// Options are not used.
+func RenderRetry(iface *Interface, options MakeOptions) ([]byte, error) {
+	if err := checkImplemented(iface, "retry decorator"); err != nil {
+		return nil, err
+	}
+	return MakeRetryCode(iface)
+}
+
+// MakeRetryCode generates the struct RetryIfaceName implementing iface by
+// calling the same methods of its field Next. The methods returning an
+// error as their last result are attempted again while they fail,
+// according to the policy set in the fields Attempts, Backoff and
+// Retryable, and guarded by the optional circuit breaker Breaker, of type
+// RetryIfaceNameBreaker. A leading context.Context parameter stops the
+// retries once it's done, and its error is returned. Other methods are only
+// forwarded.
+func MakeRetryCode(iface *Interface) ([]byte, error) {
+	targs, err := typeParamNames(iface.TypeParams)
+	if err != nil {
+		return nil, err
+	}
+	retry := "Retry" + iface.IfaceName
+	breaker := retry + "Breaker"
+
+	imports := &decoratorImports{iface: iface}
+	contextPkg := imports.use("context")
+	timePkg := imports.use("time")
+
+	// The fields and helpers of the decorator must not be named like the
+	// methods of the interface.
+	next, attempts, backoff := memberName(iface, "Next"), memberName(iface, "Attempts"), memberName(iface, "Backoff")
+	retryable, breakerField := memberName(iface, "Retryable"), memberName(iface, "Breaker")
+	callHelper, retryHelper := memberName(iface, "call"), memberName(iface, "retry")
+
+	var b strings.Builder
+	writeHeader(&b, iface, imports.specs)
+	fmt.Fprintf(&b, "// %s implements %s by calling the methods of %s returning an error\n", retry, iface.IfaceName, next)
+	b.WriteString("// again while they fail, according to its policy.\n")
+	fmt.Fprintf(&b, "type %s%s struct {\n%s %s%s\n", retry, iface.TypeParams, next, iface.IfaceName, targs)
+	fmt.Fprintf(&b, "// %s is the maximum number of calls of a method, one if it\n// is not positive.\n%s int\n", attempts, attempts)
+	fmt.Fprintf(&b, "// %s returns the delay before the attempt following attempt,\n// starting at 1. Attempts follow each other immediately if it is nil.\n", backoff)
+	fmt.Fprintf(&b, "%s func(attempt int) %s.Duration\n", backoff, timePkg)
+	fmt.Fprintf(&b, "// %s reports whether a call that failed with err is attempted\n// again. Every error is if it is nil.\n%s func(err error) bool\n", retryable, retryable)
+	fmt.Fprintf(&b, "// %s, if not nil, is a circuit breaker guarding every attempt.\n", breakerField)
+	fmt.Fprintf(&b, "%s %s\n}\n", breakerField, breaker)
+	writeImplements(&b, iface, retry+targs+"{}")
+
+	fmt.Fprintf(&b, "\n// %s is a circuit breaker guarding the calls of %s.\n", breaker, retry)
+	fmt.Fprintf(&b, "type %s interface {\n", breaker)
+	fmt.Fprintf(&b, "// Allow returns an error, returned to the caller without calling\n// %s, when calls are not allowed at the moment.\nAllow() error\n", next)
+	b.WriteString("// Done records the error, or nil, returned by an allowed call.\nDone(err error)\n}\n")
+
+	fmt.Fprintf(&b, "\n// %s calls fn, guarded by the circuit breaker.\n", callHelper)
+	fmt.Fprintf(&b, "func (r %s%s) %s(fn func() error) error {\n", retry, targs, callHelper)
+	fmt.Fprintf(&b, "if r.%s != nil {\nif err := r.%s.Allow(); err != nil {\nreturn err\n}\n}\n", breakerField, breakerField)
+	fmt.Fprintf(&b, "err := fn()\nif r.%s != nil {\nr.%s.Done(err)\n}\nreturn err\n}\n", breakerField, breakerField)
+
+	fmt.Fprintf(&b, "\n// %s waits for the backoff before the attempt following attempt, which\n", retryHelper)
+	b.WriteString("// failed with err. It returns nil to make that attempt, or the error to\n")
+	b.WriteString("// return: err if it isn't retried, or the error of ctx once it's done.\n")
+	fmt.Fprintf(&b, "func (r %s%s) %s(ctx %s.Context, attempt int, err error) error {\n", retry, targs, retryHelper, contextPkg)
+	fmt.Fprintf(&b, "if attempt >= r.%s || (r.%s != nil && !r.%s(err)) {\nreturn err\n}\n", attempts, retryable, retryable)
+	b.WriteString("if err := ctx.Err(); err != nil {\nreturn err\n}\n")
+	fmt.Fprintf(&b, "var delay %s.Duration\nif r.%s != nil {\ndelay = r.%s(attempt)\n}\n", timePkg, backoff, backoff)
+	fmt.Fprintf(&b, "timer := %s.NewTimer(delay)\ndefer timer.Stop()\n", timePkg)
+	b.WriteString("select {\ncase <-ctx.Done():\ncase <-timer.C:\n}\nreturn ctx.Err()\n}\n")
+
+	for _, m := range iface.Methods {
+		d := newDecoratedMethod(m, imports.names)
+		recv := d.declare("r")
+		call := d.call(recv + "." + next)
+		if !d.returnsError() {
+			fmt.Fprintf(&b, "\n// %s calls %s.%s.\n", m.Name, next, m.Name)
+			b.WriteString(d.signature(recv, retry+targs))
+			if len(m.Results) > 0 {
+				call = "return " + call
+			}
+			b.WriteString(call + "\n}\n")
+			continue
+		}
+
+		fmt.Fprintf(&b, "\n// %s calls %s.%s until it succeeds or isn't retried.\n", m.Name, next, m.Name)
+		b.WriteString(d.signature(recv, retry+targs))
+		ctx := d.context()
+		if ctx == "" {
+			ctx = contextPkg + ".Background()"
+		}
+		attempt := d.declare("attempt")
+		vars := d.resultVars()
+		errVar := vars[len(vars)-1]
+		for i, v := range vars[:len(vars)-1] {
+			fmt.Fprintf(&b, "var %s %s\n", v, m.Results[i].Type)
+		}
+		fmt.Fprintf(&b, "for %s := 1; ; %s++ {\n", attempt, attempt)
+		if len(vars) == 1 {
+			fmt.Fprintf(&b, "%s := %s.%s(func() error {\nreturn %s\n})\n", errVar, recv, callHelper, call)
+		} else {
+			fmt.Fprintf(&b, "%s := %s.%s(func() (%s error) {\n", errVar, recv, callHelper, errVar)
+			fmt.Fprintf(&b, "%s = %s\nreturn %s\n})\n", strings.Join(vars, ", "), call, errVar)
+		}
+		fmt.Fprintf(&b, "if %s == nil {\nreturn %s\n}\n", errVar, strings.Join(vars, ", "))
+		fmt.Fprintf(&b, "if %s = %s.%s(%s, %s, %s); %s != nil {\n", errVar, recv, retryHelper, ctx, attempt, errVar, errVar)
+		fmt.Fprintf(&b, "return %s\n}\n}\n}\n", strings.Join(vars, ", "))
+	}
+	return FormatCode(b.String())
+}
@@ -0,0 +1,118 @@
+package maker
+
+import (
+	"fmt"
+	"go/token"
+	"slices"
+	"strings"
+)
+
+// RoleOptions describes a role interface, made of some of the methods of
+// the struct, generated together with the other roles of MakeOptions.Roles.
+type RoleOptions struct {
+	Name string
+	// Comment is the doc comment of the interface, without the
+	// leading "//".
+	Comment string
+	// Include and Exclude select the methods of the role by name, like
+	// MakeOptions.Include and MakeOptions.Exclude, but no method is
+	// selected without Include. Methods with an only directive are in the
+	// roles it lists instead.
+	Include []string
+	Exclude []string
+}
+
+// Role is an interface made of some of the methods of the source type.
+type Role struct {
+	Name string
+	// Comment is the doc comment of the interface, without the
+	// leading "//".
+	Comment string
+	Methods []Method
+}
+
+// ParseRole parses a role given as "Name=pattern,pattern,...", where a
+// pattern starting with "!" excludes methods, e.g.
+// "UserWriter=*,!Get*,!List*". A role given as "Name" only has the methods
+// whose only directive lists it.
+func ParseRole(s string) (RoleOptions, error) {
+	name, patterns, _ := strings.Cut(s, "=")
+	if !token.IsIdentifier(name) {
+		return RoleOptions{}, fmt.Errorf("invalid role %q, expected Name=pattern,...", s)
+	}
+	role := RoleOptions{Name: name}
+	if patterns == "" {
+		return role, nil
+	}
+	for _, p := range strings.Split(patterns, ",") {
+		if exclude, ok := strings.CutPrefix(p, "!"); ok {
+			role.Exclude = append(role.Exclude, exclude)
+		} else {
+			role.Include = append(role.Include, p)
+		}
+	}
+	return role, nil
+}
+
+// splitRoles distributes the methods of data among roles. Methods that
+// aren't in any role are left out of data.Methods and reported in a
+// warning, as are roles without methods.
+func splitRoles(data *Interface, roles []RoleOptions) error {
+	inRole := make(map[string]bool)
+	for _, r := range roles {
+		include, err := parseNamePatterns(r.Include)
+		if err != nil {
+			return fmt.Errorf("role %s: %w", r.Name, err)
+		}
+		exclude, err := parseNamePatterns(r.Exclude)
+		if err != nil {
+			return fmt.Errorf("role %s: %w", r.Name, err)
+		}
+
+		role := Role{Name: r.Name, Comment: r.Comment}
+		for _, m := range data.Methods {
+			if only, ok := m.Directive("only"); ok {
+				if slices.Contains(strings.Split(only, ","), r.Name) {
+					role.Methods = append(role.Methods, m)
+				}
+				continue
+			}
+			included := matchAny(include, m.Name)
+			if excluded := matchAny(exclude, m.Name); included && !excluded {
+				role.Methods = append(role.Methods, m)
+			}
+		}
+		if len(role.Methods) == 0 {
+			data.Warnings = append(data.Warnings, fmt.Sprintf("role %s has no methods", r.Name))
+		}
+		for _, m := range role.Methods {
+			inRole[m.Name] = true
+		}
+		data.Roles = append(data.Roles, role)
+	}
+
+	var methods []Method
+	for _, m := range data.Methods {
+		if inRole[m.Name] {
+			methods = append(methods, m)
+		} else {
+			data.Warnings = append(data.Warnings, fmt.Sprintf("method %s of %s is in no role", m.Name, data.StructName))
+		}
+	}
+	data.Methods = methods
+	return nil
+}
+
+// roleEmbeds returns the references to the roles of d embedded in the
+// composite interface.
+func (d *Interface) roleEmbeds() ([]string, error) {
+	targs, err := typeParamNames(d.TypeParams)
+	if err != nil {
+		return nil, err
+	}
+	embeds := make([]string, len(d.Roles))
+	for i, r := range d.Roles {
+		embeds[i] = r.Name + targs
+	}
+	return embeds, nil
+}
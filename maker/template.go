@@ -0,0 +1,114 @@
+package maker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// DefaultTemplate is the text/template used to render the interface file
+// when no other template is given. It is executed with a *TemplateData.
+const DefaultTemplate = `// {{.Comment}}
+
+package {{.PkgName}}
+
+import (
+{{- range .Imports}}
+{{.}}
+{{- end}}
+)
+
+{{- range .Roles}}
+{{with .Comment}}{{comment .}}
+{{end -}}
+type {{.Name}}{{$.TypeParams}} interface {
+{{- range .Methods}}
+{{- range .Docs}}
+{{.}}
+{{- end}}
+{{.Code}}
+{{- end}}
+}
+
+{{end -}}
+{{- if .IfaceName}}
+{{with .IfaceComment}}{{comment .}}
+{{end -}}
+type {{.IfaceName}}{{.TypeParams}} interface {
+{{- range .Embeds}}
+{{.}}
+{{- end}}
+{{- range .Methods}}
+{{- range .Docs}}
+{{.}}
+{{- end}}
+{{.Code}}
+{{- end}}
+}
+{{- end}}
+{{- with .Assertion}}
+
+{{.}}
+{{- end}}
+`
+
+// TemplateData is the model an output template is executed with. Use the
+// comment function to render the IfaceComment. With roles, the Embeds of
+// the composite interface IfaceName start with the roles, and Methods is
+// empty.
+type TemplateData struct {
+	Interface
+	// Assertion is the compile-time assertion that the struct implements
+	// the interface when it is requested, or empty.
+	Assertion string
+}
+
+// templateFuncs are the functions available to output templates.
+var templateFuncs = template.FuncMap{
+	// comment turns text into a // comment, keeping directives intact.
+	"comment": func(text string) string {
+		prefix := "// "
+		if reMatchDirective.MatchString(text) {
+			prefix = "//"
+		}
+		return prefix + strings.ReplaceAll(text, "\n", "\n// ")
+	},
+	"join": strings.Join,
+}
+
+// ParseTemplate parses an output template, the functions of templateFuncs
+// are available to it.
+func ParseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Parse(text)
+}
+
+// defaultTemplate is the parsed DefaultTemplate.
+var defaultTemplate = template.Must(ParseTemplate("default", DefaultTemplate))
+
+// loadTemplate returns the template read from the file path, or the
+// default template if path is empty.
+func loadTemplate(path string) (*template.Template, error) {
+	if path == "" {
+		return defaultTemplate, nil
+	}
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTemplate(filepath.Base(path), string(text))
+}
+
+// RenderTemplate executes tmpl with data and formats the result as Go code.
+func RenderTemplate(tmpl *template.Template, data *TemplateData) ([]byte, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return nil, err
+	}
+	code, err := FormatCode(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %w", tmpl.Name(), err)
+	}
+	return code, nil
+}
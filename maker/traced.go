@@ -0,0 +1,102 @@
+package maker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The OpenTelemetry packages used by the generated tracing decorators.
+const (
+	otelTraceImport = "go.opentelemetry.io/otel/trace"
+	otelCodesImport = "go.opentelemetry.io/otel/codes"
+)
+
+// MakeTraced generates a decorator of the interface described by options
+// recording an OpenTelemetry span around every call. The decorator is
+// named after the interface, e.g. TracedStore, belongs to the same package
+// and is meant to be written to a separate file next to it.
+func MakeTraced(options MakeOptions) ([]byte, error) {
+	return NewGenerator().MakeTraced(options)
+}
+
+// MakeTraced generates a tracing decorator of the interface described by
+// options, see MakeTraced.
+func (g *Generator) MakeTraced(options MakeOptions) ([]byte, error) {
+	data, err := g.cache.collectImplemented(options)
+	if err != nil {
+		return nil, err
+	}
+	return RenderTraced(data, options)
+}
+
+// RenderTraced renders the tracing decorator of iface, see MakeTraced.
+// Options are not used.
+func RenderTraced(iface *Interface, options MakeOptions) ([]byte, error) {
+	if err := checkImplemented(iface, "tracing decorator"); err != nil {
+		return nil, err
+	}
+	return MakeTracedCode(iface)
+}
+
+// MakeTracedCode generates the struct TracedIfaceName implementing iface
+// by calling the same methods of its field Next within a span started with
+// its Tracer. The span of a method is named IfaceName.Method. A leading
+// context.Context parameter is the parent of the span and the context
+// passed on to Next carries it. An error returned as the last result is
+// recorded on the span, whose status is then set to codes.Error.
+func MakeTracedCode(iface *Interface) ([]byte, error) {
+	targs, err := typeParamNames(iface.TypeParams)
+	if err != nil {
+		return nil, err
+	}
+	traced := "Traced" + iface.IfaceName
+	next, tracer := memberName(iface, "Next"), memberName(iface, "Tracer")
+
+	imports := &decoratorImports{iface: iface}
+	contextPkg := imports.use("context")
+	tracePkg := imports.use(otelTraceImport)
+	codesPkg := imports.use(otelCodesImport)
+
+	var b strings.Builder
+	writeHeader(&b, iface, imports.specs)
+	fmt.Fprintf(&b, "// %s implements %s by recording a span around every call to %s.\n", traced, iface.IfaceName, next)
+	fmt.Fprintf(&b, "type %s%s struct {\n%s %s%s\n%s %s.Tracer\n}\n", traced, iface.TypeParams, next, iface.IfaceName, targs, tracer, tracePkg)
+	writeImplements(&b, iface, traced+targs+"{}")
+	fmt.Fprintf(&b, "\n// New%s returns a %s recording the calls to next with tracer.\n", traced, traced)
+	fmt.Fprintf(&b, "func New%s%s(next %s%s, tracer %s.Tracer) %s%s {\n", traced, iface.TypeParams, iface.IfaceName, targs, tracePkg, traced, targs)
+	fmt.Fprintf(&b, "return %s%s{%s: next, %s: tracer}\n}\n", traced, targs, next, tracer)
+
+	for _, m := range iface.Methods {
+		d := newDecoratedMethod(m, imports.names)
+		recv := d.declare("t")
+		fmt.Fprintf(&b, "\n// %s calls %s.%s within a span.\n", m.Name, next, m.Name)
+		b.WriteString(d.signature(recv, traced+targs))
+
+		spanName := strconv.Quote(iface.IfaceName + "." + m.Name)
+		span := d.declare("span")
+		if ctx := d.context(); ctx != "" {
+			fmt.Fprintf(&b, "%s, %s := %s.%s.Start(%s, %s)\n", ctx, span, recv, tracer, ctx, spanName)
+		} else {
+			fmt.Fprintf(&b, "_, %s := %s.%s.Start(%s.Background(), %s)\n", span, recv, tracer, contextPkg, spanName)
+		}
+		fmt.Fprintf(&b, "defer %s.End()\n", span)
+
+		call := d.call(recv + "." + next)
+		if !d.returnsError() {
+			if len(m.Results) > 0 {
+				call = "return " + call
+			}
+			b.WriteString(call + "\n}\n")
+			continue
+		}
+		vars := d.resultVars()
+		errVar := vars[len(vars)-1]
+		fmt.Fprintf(&b, "%s := %s\n", strings.Join(vars, ", "), call)
+		fmt.Fprintf(&b, "if %s != nil {\n", errVar)
+		fmt.Fprintf(&b, "%s.RecordError(%s)\n", span, errVar)
+		fmt.Fprintf(&b, "%s.SetStatus(%s.Error, %s.Error())\n}\n", span, codesPkg, errVar)
+		fmt.Fprintf(&b, "return %s\n}\n", strings.Join(vars, ", "))
+	}
+	return FormatCode(b.String())
+}
@@ -0,0 +1,86 @@
+package maker
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// UsedMethods returns the names of the methods of the type typeName,
+// declared in the package with the import path pkgPath, that are called on
+// fields and parameters of that type, or of a pointer to it, in the
+// consumer package pkg.
+func UsedMethods(pkg *packages.Package, pkgPath, typeName string) map[string]struct{} {
+	used := make(map[string]struct{})
+	for expr, sel := range pkg.TypesInfo.Selections {
+		if sel.Kind() != types.MethodVal || !isNamedType(sel.Recv(), pkgPath, typeName) {
+			continue
+		}
+		if v := selectedVar(pkg.TypesInfo, expr.X); v != nil && (v.Kind() == types.ParamVar || v.Kind() == types.FieldVar) {
+			used[sel.Obj().Name()] = struct{}{}
+		}
+	}
+	return used
+}
+
+// isNamedType reports whether t is, or points to, the named type typeName
+// declared in the package with the import path pkgPath. Instances of
+// generic types match their generic type.
+func isNamedType(t types.Type, pkgPath, typeName string) bool {
+	if ptr, ok := types.Unalias(t).(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Origin().Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == pkgPath && obj.Name() == typeName
+}
+
+// selectedVar returns the variable expr refers to, either directly by name
+// or by selecting a struct field, or nil.
+func selectedVar(info *types.Info, expr ast.Expr) *types.Var {
+	switch e := ast.Unparen(expr).(type) {
+	case *ast.Ident:
+		v, _ := info.Uses[e].(*types.Var)
+		return v
+	case *ast.SelectorExpr:
+		if sel, ok := info.Selections[e]; ok && sel.Kind() == types.FieldVal {
+			return sel.Obj().(*types.Var)
+		}
+	}
+	return nil
+}
+
+// filterUsed removes the methods not used by the consumer package
+// options.UsedBy from data.
+func (c *sourceCache) filterUsed(data *Interface, options MakeOptions) error {
+	pkgPath, err := data.structImportPath()
+	if err != nil {
+		return fmt.Errorf("can't find the import path of %s.%s: %w", data.StructPkg, data.StructName, err)
+	}
+	consumer, err := c.loadPackage(options.Dir, options.UsedBy, options.Build)
+	if err != nil {
+		return err
+	}
+
+	used := UsedMethods(consumer, pkgPath, data.StructName)
+	var methods []Method
+	for _, m := range data.Methods {
+		name := m.Name
+		if m.Original != "" {
+			name = m.Original
+		}
+		if _, ok := used[name]; ok {
+			methods = append(methods, m)
+		}
+	}
+	if len(methods) == 0 {
+		return fmt.Errorf("no methods of %s.%s are called in %s", data.StructPkg, data.StructName, consumer.PkgPath)
+	}
+	data.Methods = methods
+	return nil
+}
@@ -0,0 +1,87 @@
+package maker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MakeWrapper generates a struct forwarding every method of the interface
+// described by options to another implementation of it, the base of
+// decorators that only override some of the methods. The struct is named
+// after the interface, e.g. StoreWrapper, belongs to the same package and
+// is meant to be written to a separate file next to it.
+func MakeWrapper(options MakeOptions) ([]byte, error) {
+	return NewGenerator().MakeWrapper(options)
+}
+
+// MakeWrapper generates a forwarding struct of the interface described by
+// options, see MakeWrapper.
+func (g *Generator) MakeWrapper(options MakeOptions) ([]byte, error) {
+	data, err := g.cache.collectImplemented(options)
+	if err != nil {
+		return nil, err
+	}
+	return RenderWrapper(data, options)
+}
+
+// RenderWrapper renders the forwarding struct of iface, see MakeWrapper.
+// Options are not used.
+func RenderWrapper(iface *Interface, options MakeOptions) ([]byte, error) {
+	if err := checkImplemented(iface, "wrapper"); err != nil {
+		return nil, err
+	}
+	return MakeWrapperCode(iface)
+}
+
+// collectImplemented collects the interface described by options for code
+// implementing it: the methods of embedded interfaces are listed as well.
+func (c *sourceCache) collectImplemented(options MakeOptions) (*Interface, error) {
+	options.EmbedInterfaces = false
+	return c.collect(options)
+}
+
+// checkImplemented returns an error when code implementing iface, kind,
+// can't be rendered: it needs the name of a composite interface of roles,
+// and all of the methods rather than embedded interfaces, which are left
+// out when collecting with MakeOptions.EmbedInterfaces.
+func checkImplemented(iface *Interface, kind string) error {
+	if iface.IfaceName == "" {
+		return fmt.Errorf("a %s of roles needs the name of a composite interface", kind)
+	}
+	if len(iface.Embeds) > 0 {
+		return fmt.Errorf("a %s needs the methods of the embedded interfaces %s, collected without embedding them", kind, strings.Join(iface.Embeds, ", "))
+	}
+	return nil
+}
+
+// MakeWrapperCode generates the struct IfaceNameWrapper implementing iface
+// by calling the same methods of its field Next, named Next_ if iface has a
+// method Next.
+func MakeWrapperCode(iface *Interface) ([]byte, error) {
+	targs, err := typeParamNames(iface.TypeParams)
+	if err != nil {
+		return nil, err
+	}
+	wrapper := iface.IfaceName + "Wrapper"
+	next := memberName(iface, "Next")
+
+	var b strings.Builder
+	writeHeader(&b, iface, nil)
+	fmt.Fprintf(&b, "// %s implements %s by forwarding every call to %s.\n", wrapper, iface.IfaceName, next)
+	b.WriteString("// Embed it into a decorator to only override some of the methods.\n")
+	fmt.Fprintf(&b, "type %s%s struct {\n%s %s%s\n}\n", wrapper, iface.TypeParams, next, iface.IfaceName, targs)
+	writeImplements(&b, iface, wrapper+targs+"{}")
+
+	for _, m := range iface.Methods {
+		d := newDecoratedMethod(m, nil)
+		recv := d.declare("w")
+		fmt.Fprintf(&b, "\n// %s calls %s.%s.\n", m.Name, next, m.Name)
+		b.WriteString(d.signature(recv, wrapper+targs))
+		call := d.call(recv + "." + next)
+		if len(m.Results) > 0 {
+			call = "return " + call
+		}
+		b.WriteString(call + "\n}\n")
+	}
+	return FormatCode(b.String())
+}